@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/dqdgit/chktiles/chklib"
+)
+
+// baselineEntry is a known result recorded in the --baseline file. Results
+// are matched on all three fields, the severity is left out so that changing
+// it with --severity doesn't bring back the results in the baseline.
+type baselineEntry struct {
+	Path    string `json:"path"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// writeBaseline records results as the baseline at path, sorted so that the
+// file only changes when the results do.
+func writeBaseline(path string, results []chklib.Result) error {
+	entries := []baselineEntry{}
+	for _, r := range results {
+		entries = append(entries, baselineEntry{r.Path, r.Check, r.Message})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		return a.Message < b.Message
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// loadBaseline reads the baseline at path, counting how many times each
+// result appears in it.
+func loadBaseline(path string) (map[baselineEntry]int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []baselineEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	known := make(map[baselineEntry]int)
+	for _, e := range entries {
+		known[e]++
+	}
+	return known, nil
+}
+
+// applyBaseline returns the results that aren't in known, and the number
+// left out. A result that is reported more often than it appears in the
+// baseline is new for the extra occurrences.
+func applyBaseline(results []chklib.Result, known map[baselineEntry]int) ([]chklib.Result, int) {
+	remaining := make(map[baselineEntry]int, len(known))
+	for e, n := range known {
+		remaining[e] = n
+	}
+
+	fresh := []chklib.Result{}
+	suppressed := 0
+	for _, r := range results {
+		e := baselineEntry{r.Path, r.Check, r.Message}
+		if remaining[e] > 0 {
+			remaining[e]--
+			suppressed++
+			continue
+		}
+		fresh = append(fresh, r)
+	}
+	return fresh, suppressed
+}
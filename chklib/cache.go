@@ -0,0 +1,107 @@
+package chklib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// hashCache remembers the hashes of files between runs so that a large
+// duplicate directory that rarely changes doesn't have to be hashed again
+// every time. Entries are keyed by absolute path and are only used while the
+// file's modification time and size are unchanged. The whole cache is
+// dropped if it was made with a different hash algorithm.
+type hashCache struct {
+	path  string
+	dirty bool
+
+	Algorithm string                    `json:"algorithm"`
+	Entries   map[string]hashCacheEntry `json:"entries"`
+}
+
+type hashCacheEntry struct {
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	Hash    string    `json:"hash"`
+}
+
+// loadHashCache reads the cache at path. A missing file gives an empty
+// cache, as does one that can't be parsed, which is reported and then
+// replaced when the cache is saved.
+func loadHashCache(path string, algorithm string) (*hashCache, error) {
+	cache := &hashCache{path: path, Algorithm: algorithm, Entries: make(map[string]hashCacheEntry)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var saved hashCache
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Fprintf(os.Stderr, "loadHashCache\tERROR\tignoring invalid cache %q, %v\n", path, err)
+		cache.dirty = true
+		return cache, nil
+	}
+
+	if saved.Algorithm == algorithm && saved.Entries != nil {
+		cache.Entries = saved.Entries
+	} else {
+		cache.dirty = true
+	}
+
+	return cache, nil
+}
+
+// cacheKey returns the key used for path in the cache.
+func cacheKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// lookup returns the cached hash of path, if there is one and the file
+// hasn't changed since it was computed.
+func (cache *hashCache) lookup(path string, info os.FileInfo) (string, bool) {
+	entry, ok := cache.Entries[cacheKey(path)]
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return entry.Hash, true
+}
+
+func (cache *hashCache) store(path string, info os.FileInfo, hash string) {
+	cache.Entries[cacheKey(path)] = hashCacheEntry{info.ModTime(), info.Size(), hash}
+	cache.dirty = true
+}
+
+// save writes the cache back to its file if it has changed. The new cache is
+// written alongside and renamed into place so that an interrupted run
+// doesn't leave a truncated cache behind.
+func (cache *hashCache) save() error {
+	if !cache.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	tmp := cache.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cache.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	cache.dirty = false
+	return nil
+}
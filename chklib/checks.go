@@ -0,0 +1,1181 @@
+package chklib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/antchfx/xmlquery"
+)
+
+const svgNs = "http://www.w3.org/2000/svg"
+const svgDcNs = "http://purl.org/dc/elements/1.1/"
+const svgCcNs = "http://creativecommons.org/ns#"
+const svgRdfNs = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// The namespaces used by editors for their own metadata.
+const sodipodiNs = "http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd"
+const inkscapeNs = "http://www.inkscape.org/namespaces/inkscape"
+const illustratorNs = "http://ns.adobe.com/AdobeIllustrator/10.0/"
+const adobeExtensionsNs = "http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/"
+
+const pxPerIn = 96
+const pxPerMm = (0.03937007874 * pxPerIn)
+const pxPerPt = (0.0138888889 * pxPerIn)
+const pxPerPc = (0.1666666667 * pxPerIn)
+const pxPerFt = (pxPerIn * 12)
+const pxPerCm = (0.3937007874 * pxPerIn)
+const pxPerM = (39.37007874 * pxPerIn)
+
+// viewBoxTolerance is the fraction by which the viewBox size may differ from
+// the width and height before checkViewBox complains.
+const viewBoxTolerance = 0.01
+
+// aspectTolerance is the fraction by which a tile's aspect ratio may differ
+// from the Aspect option before checkAspectRatio complains.
+const aspectTolerance = 0.01
+
+// headSize is the number of bytes at the start of each document kept for
+// checkEncoding, enough for any byte order mark and XML declaration.
+const headSize = 256
+
+// numberRe matches the number at the start of a length value.
+var numberRe = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+
+// toFloat converts the leading number of a length value such as "-1.5e2px"
+// to a float, ignoring any unit that follows it.
+func toFloat(s string) float64 {
+	f, err := strconv.ParseFloat(numberRe.FindString(strings.TrimSpace(s)), 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "toFloat\tERROR\tunable to convert %q, %v\n", s, err)
+	}
+	return f
+}
+
+// pxPerUnit maps each absolute length unit to the number of px it contains.
+// These are the units that can be converted to px and compared against the
+// minimum tile size.
+var pxPerUnit = map[string]float64{
+	"px": 1.0,
+	"in": pxPerIn,
+	"mm": pxPerMm,
+	"pt": pxPerPt,
+	"pc": pxPerPc,
+	"ft": pxPerFt,
+	"cm": pxPerCm,
+	"m":  pxPerM,
+}
+
+// relativeUnits are the units whose size in px depends on the context the
+// tile is rendered in (font size, viewport or parent element), so they can't
+// be converted to px.
+var relativeUnits = map[string]bool{
+	"%":  true,
+	"em": true,
+	"ex": true,
+	"vw": true,
+	"vh": true,
+}
+
+var unitRe = regexp.MustCompile(`([a-z%]+)$`)
+
+// getUnit returns the unit suffix of a length value, or "" if it has none.
+func getUnit(value string) string {
+	m := unitRe.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// isRelativeUnit reports whether value uses one of the context dependent
+// units.
+func isRelativeUnit(value string) bool {
+	return relativeUnits[getUnit(value)]
+}
+
+// unitConversion returns the number of px in one unit of a length value. A
+// value without a unit is already in px. Relative and unknown units are an
+// error.
+func unitConversion(value string) (float64, error) {
+	unit := getUnit(value)
+	if unit == "" {
+		return 1.0, nil
+	}
+	if f, ok := pxPerUnit[unit]; ok {
+		return f, nil
+	}
+	if relativeUnits[unit] {
+		return 0, fmt.Errorf("relative unit %q can't be converted to px", unit)
+	}
+	return 0, fmt.Errorf("unknown unit %q", unit)
+}
+
+// getUnitConversion is unitConversion for the checks that have already
+// skipped relative units. Unknown units are treated as px, checkUnits
+// reports them.
+func getUnitConversion(value string) float64 {
+	f, err := unitConversion(value)
+	if err != nil {
+		return 1.0
+	}
+	return f
+}
+
+// parseViewBox returns the four numbers of a viewBox attribute, which may be
+// separated by whitespace and/or commas.
+func parseViewBox(value string) ([]float64, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected 4 numbers, found %d", len(fields))
+	}
+
+	var numbers []float64
+	for _, field := range fields {
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, f)
+	}
+
+	return numbers, nil
+}
+
+// getLengths returns the width and height attributes of the svg element.
+// When either is absent the corresponding size is taken from the viewBox
+// instead.
+func getLengths(n *xmlquery.Node) (string, string) {
+	w := n.SelectAttr("width")
+	h := n.SelectAttr("height")
+
+	if w == "" || h == "" {
+		if vb, err := parseViewBox(n.SelectAttr("viewBox")); err == nil {
+			if w == "" {
+				w = strconv.FormatFloat(vb[2], 'f', -1, 64)
+			}
+			if h == "" {
+				h = strconv.FormatFloat(vb[3], 'f', -1, 64)
+			}
+		}
+	}
+
+	return w, h
+}
+
+// getDimensions returns the width and height of the svg element as numbers,
+// without any unit conversion.
+func getDimensions(n *xmlquery.Node) (float64, float64) {
+	w, h := getLengths(n)
+	return toFloat(w), toFloat(h)
+}
+
+// checkKeywords reports tiles with no keywords, and warns about those with
+// fewer than MinKeywords non-empty ones or with the same keyword more than
+// once, ignoring case.
+func checkKeywords(c *collector, path string, node *xmlquery.Node) {
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//rdf:li")
+	if len(nodes) == 0 {
+		c.add(path, "checkKeywords", SeverityError, "Keywords missing")
+		return
+	}
+
+	count := 0
+	seen := make(map[string]int)
+	var duplicates []string
+	for _, n := range nodes {
+		keyword := strings.TrimSpace(n.InnerText())
+		if keyword == "" {
+			continue
+		}
+		count++
+
+		key := strings.ToLower(keyword)
+		seen[key]++
+		if seen[key] == 2 {
+			duplicates = append(duplicates, keyword)
+		}
+	}
+
+	if count < c.opts.MinKeywords {
+		c.add(path, "checkKeywords", SeverityWarning, "Only %d keyword(s), at least %d are required", count, c.opts.MinKeywords)
+	}
+
+	if len(duplicates) > 0 {
+		c.add(path, "checkKeywords", SeverityWarning, "Duplicate keywords: %s", strings.Join(duplicates, ", "))
+	}
+}
+
+func checkSize(c *collector, path string, node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg")
+	if n == nil {
+		c.add(path, "checkSize", SeverityError, "SVG element missing")
+		return
+	}
+	w, h := getDimensions(n)
+
+	if c.opts.MinWidth > 0 && !isRelativeUnit(n.SelectAttr("width")) && w < float64(c.opts.MinWidth) {
+		c.add(path, "checkSize", SeverityError, "Width (%f) is too small", w)
+	}
+
+	if c.opts.MinHeight > 0 && !isRelativeUnit(n.SelectAttr("height")) && h < float64(c.opts.MinHeight) {
+		c.add(path, "checkSize", SeverityError, "Height (%f) is too small", h)
+	}
+}
+
+func checkUnits(c *collector, path string, node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg")
+	if n == nil {
+		c.add(path, "checkUnits", SeverityError, "SVG element missing")
+		return
+	}
+	w := n.SelectAttr("width")
+	h := n.SelectAttr("height")
+
+	if w == "" && h == "" {
+		return
+	}
+
+	if isRelativeUnit(w) {
+		c.add(path, "checkUnits", SeverityWarning, "Width units are relative, %q, size can't be checked", w)
+	} else if u, err := unitConversion(w); err != nil {
+		c.add(path, "checkUnits", SeverityWarning, "Width units are unknown, %q", w)
+	} else if u != 1.0 {
+		c.add(path, "checkUnits", SeverityWarning, "Width units are not px, %q", w)
+	}
+
+	if isRelativeUnit(h) {
+		c.add(path, "checkUnits", SeverityWarning, "Height units are relative, %q, size can't be checked", h)
+	} else if u, err := unitConversion(h); err != nil {
+		c.add(path, "checkUnits", SeverityWarning, "Height units are unknown, %q", h)
+	} else if u != 1.0 {
+		c.add(path, "checkUnits", SeverityWarning, "Height units are not px, %q", h)
+	}
+}
+
+// checkIdentifier verifies that dc:identifier is present and that it matches
+// the file name. The comparison ignores case and a trailing ".svg" or
+// ".svgz".
+func checkIdentifier(c *collector, path string, node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//dc:identifier")
+	if n == nil {
+		c.add(path, "checkIdentifier", SeverityError, "Identifier missing")
+		return
+	}
+
+	// A document read with CheckReader may not have a file name to compare
+	// with.
+	if !isSvgPath(path) {
+		return
+	}
+
+	id := strings.TrimSpace(n.InnerText())
+	name := trimSvgExt(strings.ToLower(filepath.Base(path)))
+	if trimSvgExt(strings.ToLower(id)) != name {
+		c.add(path, "checkIdentifier", SeverityWarning, "Identifier %q does not match the file name", id)
+	}
+}
+
+// checkCreator verifies that the metadata names the tile's creator, either
+// directly in dc:creator or in its nested cc:Agent/dc:title.
+func checkCreator(c *collector, path string, node *xmlquery.Node) {
+	n := xmlquery.FindOne(node, nsQuery(svgDcNs, "creator"))
+	if n == nil || strings.TrimSpace(n.InnerText()) == "" {
+		c.add(path, "checkCreator", SeverityError, "Creator missing")
+	}
+}
+
+func checkTitle(c *collector, path string, node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg/title")
+	if n == nil {
+		c.add(path, "checkTitle", SeverityError, "Title missing")
+	} else if strings.TrimSpace(n.InnerText()) == "" {
+		c.add(path, "checkTitle", SeverityWarning, "Title is empty")
+	}
+}
+
+// checkTitleMatch warns when the <title> and the dc:title of the metadata
+// cc:Work don't agree. The dc:title elements naming the creator or rights
+// holder in a cc:Agent are ignored. A missing title is left to checkTitle
+// and checkMetadataStructure.
+func checkTitleMatch(c *collector, path string, node *xmlquery.Node) {
+	title := xmlquery.FindOne(node, "//svg/title")
+	if title == nil {
+		return
+	}
+
+	work := metadataWork(node)
+	if work == nil {
+		return
+	}
+	dcTitle := childElement(work, svgDcNs, "title")
+	if dcTitle == nil {
+		return
+	}
+
+	t := strings.TrimSpace(title.InnerText())
+	dc := strings.TrimSpace(dcTitle.InnerText())
+	if t != dc {
+		c.add(path, "checkTitleMatch", SeverityWarning, "Title %q does not match dc:title %q", t, dc)
+	}
+}
+
+func checkDescription(c *collector, path string, node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg/desc")
+	if n == nil {
+		c.add(path, "checkDescription", SeverityWarning, "Description missing")
+	} else if strings.TrimSpace(n.InnerText()) == "" {
+		c.add(path, "checkDescription", SeverityWarning, "Description is empty")
+	}
+}
+
+// checkViewBox verifies that the viewBox size agrees with the width and
+// height of the svg element once they have been converted to px.
+func checkViewBox(c *collector, path string, node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg")
+	if n == nil {
+		return
+	}
+
+	v := n.SelectAttr("viewBox")
+	if v == "" {
+		return
+	}
+
+	vb, err := parseViewBox(v)
+	if err != nil {
+		c.add(path, "checkViewBox", SeverityError, "Malformed viewBox %q, %v", v, err)
+		return
+	}
+
+	w := n.SelectAttr("width")
+	if w != "" && !isRelativeUnit(w) {
+		px := toFloat(w) * getUnitConversion(w)
+		if math.Abs(px-vb[2]) > vb[2]*viewBoxTolerance {
+			c.add(path, "checkViewBox", SeverityWarning, "Width (%f px) does not match viewBox width (%f)", px, vb[2])
+		}
+	}
+
+	h := n.SelectAttr("height")
+	if h != "" && !isRelativeUnit(h) {
+		px := toFloat(h) * getUnitConversion(h)
+		if math.Abs(px-vb[3]) > vb[3]*viewBoxTolerance {
+			c.add(path, "checkViewBox", SeverityWarning, "Height (%f px) does not match viewBox height (%f)", px, vb[3])
+		}
+	}
+}
+
+// checkViewBoxPresent warns when the root <svg> has no viewBox and one can't
+// be inferred from an absolute width and height, since the tile can't be
+// scaled.
+func checkViewBoxPresent(c *collector, path string, node *xmlquery.Node) {
+	n := xmlquery.FindOne(node, "//svg")
+	if n == nil || n.SelectAttr("viewBox") != "" {
+		return
+	}
+
+	w := n.SelectAttr("width")
+	h := n.SelectAttr("height")
+	if w != "" && h != "" && !isRelativeUnit(w) && !isRelativeUnit(h) {
+		return
+	}
+
+	c.add(path, "checkViewBoxPresent", SeverityWarning, "No viewBox, and no width and height to infer one from")
+}
+
+// parseAspect converts an aspect ratio such as "4:3" to a width / height
+// ratio. "any" returns 0.
+func parseAspect(value string) (float64, error) {
+	if value == "any" || value == "" {
+		return 0, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("aspect ratio %q is not of the form W:H", value)
+	}
+
+	w, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("aspect ratio %q is not of the form W:H", value)
+	}
+	h, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("aspect ratio %q is not of the form W:H", value)
+	}
+	if w <= 0 || h <= 0 {
+		return 0, fmt.Errorf("aspect ratio %q must be positive", value)
+	}
+
+	return w / h, nil
+}
+
+// checkAspectRatio compares the ratio of the tile's width to height, after
+// unit conversion, with the ratio given by the Aspect option.
+func checkAspectRatio(c *collector, path string, node *xmlquery.Node) {
+	if c.aspectRatio == 0 {
+		return
+	}
+
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg")
+	if n == nil {
+		return
+	}
+
+	w, h := getLengths(n)
+	if w == "" || h == "" || isRelativeUnit(w) || isRelativeUnit(h) {
+		return
+	}
+
+	wPx := toFloat(w) * getUnitConversion(w)
+	hPx := toFloat(h) * getUnitConversion(h)
+	if hPx == 0 {
+		return
+	}
+
+	ratio := wPx / hPx
+	if math.Abs(ratio-c.aspectRatio) > c.aspectRatio*aspectTolerance {
+		c.add(path, "checkAspectRatio", SeverityWarning, "Aspect ratio (%f) does not match %s", ratio, c.opts.Aspect)
+	}
+}
+
+// getHref returns the href of n, falling back to the older xlink:href.
+func getHref(n *xmlquery.Node) string {
+	if href := n.SelectAttr("href"); href != "" {
+		return href
+	}
+	return n.SelectAttr("xlink:href")
+}
+
+// dataURISize returns the number of bytes encoded in a data: URI.
+func dataURISize(uri string) int {
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		return 0
+	}
+	header, data := uri[:comma], uri[comma+1:]
+
+	if !strings.HasSuffix(header, ";base64") {
+		return len(data)
+	}
+
+	data = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, data)
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return base64.StdEncoding.DecodedLen(len(data))
+	}
+	return len(decoded)
+}
+
+// checkEmbeddedImages reports raster images embedded in the tile as data:
+// URIs that are larger than MaxImageBytes.
+func checkEmbeddedImages(c *collector, path string, node *xmlquery.Node) {
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//image")
+
+	for _, n := range nodes {
+		href := getHref(n)
+		if !strings.HasPrefix(href, "data:image/") {
+			continue
+		}
+
+		size := dataURISize(href)
+		if size > c.opts.MaxImageBytes {
+			c.add(path, "checkEmbeddedImages", SeverityWarning, "Embedded raster image (%d bytes)", size)
+		}
+	}
+}
+
+// windowsPathRe matches an absolute Windows path, either starting with a
+// drive letter or a UNC path.
+var windowsPathRe = regexp.MustCompile(`^([a-zA-Z]:[\\/]|\\\\)`)
+
+// isLocalPath reports whether href is an absolute path on the machine the
+// tile was made on, such as /Users/alice/tile.png, C:\tiles\tile.png or a
+// file: URI. These usually come from dragging a file into an editor.
+func isLocalPath(href string) bool {
+	if strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//") {
+		return true
+	}
+	return windowsPathRe.MatchString(href) || strings.HasPrefix(strings.ToLower(href), "file:")
+}
+
+// checkExternalRefs reports any element whose href refers to something
+// outside the tile. References to fragments within the document and data:
+// URIs are allowed. Absolute paths to local files are reported separately
+// from other references since they can never work once the tile is
+// published.
+func checkExternalRefs(c *collector, path string, node *xmlquery.Node) {
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*")
+
+	for _, n := range nodes {
+		href := strings.TrimSpace(getHref(n))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "data:") {
+			continue
+		}
+
+		if isLocalPath(href) {
+			c.add(path, "checkExternalRefs", SeverityError, "Absolute local file path %q in <%s>", href, n.Data)
+		} else {
+			c.add(path, "checkExternalRefs", SeverityError, "External reference %q in <%s>", href, n.Data)
+		}
+	}
+}
+
+// checkScripts reports script elements and event handler attributes such as
+// onclick or onload, neither of which are allowed in tiles.
+func checkScripts(c *collector, path string, node *xmlquery.Node) {
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//script")
+	if len(nodes) > 0 {
+		c.add(path, "checkScripts", SeverityError, "Contains %d script element(s)", len(nodes))
+	}
+
+	nodes = xmlquery.Find(node, "//*")
+	for _, n := range nodes {
+		for _, attr := range n.Attr {
+			if strings.HasPrefix(strings.ToLower(attr.Name.Local), "on") {
+				c.add(path, "checkScripts", SeverityError, "Event handler %q on <%s>", attr.Name.Local, n.Data)
+			}
+		}
+	}
+}
+
+// checkForeignObjects reports foreignObject elements, whose content the
+// tile renderer doesn't support and silently leaves out.
+func checkForeignObjects(c *collector, path string, node *xmlquery.Node) {
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//foreignObject")
+	for _, n := range nodes {
+		if id := n.SelectAttr("id"); id != "" {
+			c.add(path, "checkForeignObjects", SeverityError, "Unsupported <foreignObject> with id %q", id)
+		} else {
+			c.add(path, "checkForeignObjects", SeverityError, "Unsupported <foreignObject>")
+		}
+	}
+}
+
+// nsQuery returns an XPath expression matching elements named local in the
+// namespace ns, whatever prefix the file happens to use for it.
+func nsQuery(ns string, local string) string {
+	return fmt.Sprintf("//*[namespace-uri()=%q and local-name()=%q]", ns, local)
+}
+
+// checkLicense verifies that the metadata declares a license, either as a
+// cc:license or dc:rights element. With RequireLicense set the cc:license
+// must refer to that specific license.
+func checkLicense(c *collector, path string, node *xmlquery.Node) {
+	license := xmlquery.FindOne(node, nsQuery(svgCcNs, "license"))
+	rights := xmlquery.FindOne(node, nsQuery(svgDcNs, "rights"))
+
+	if c.opts.RequireLicense == "" {
+		if license == nil && rights == nil {
+			c.add(path, "checkLicense", SeverityWarning, "License missing")
+		}
+		return
+	}
+
+	if license == nil {
+		c.add(path, "checkLicense", SeverityError, "License missing, %q is required", c.opts.RequireLicense)
+		return
+	}
+
+	if url := license.SelectAttr("rdf:resource"); url != c.opts.RequireLicense {
+		c.add(path, "checkLicense", SeverityError, "License %q does not match the required %q", url, c.opts.RequireLicense)
+	}
+}
+
+// childElement returns the first child of n named local in the namespace
+// ns, or nil if there isn't one.
+func childElement(n *xmlquery.Node, ns string, local string) *xmlquery.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == xmlquery.ElementNode && child.NamespaceURI == ns && child.Data == local {
+			return child
+		}
+	}
+	return nil
+}
+
+// metadataWork returns the cc:Work in the rdf:RDF block of the metadata,
+// or nil if there isn't one.
+func metadataWork(node *xmlquery.Node) *xmlquery.Node {
+	metadata := xmlquery.FindOne(node, nsQuery(svgNs, "metadata"))
+	if metadata == nil {
+		return nil
+	}
+	rdf := childElement(metadata, svgRdfNs, "RDF")
+	if rdf == nil {
+		return nil
+	}
+	return childElement(rdf, svgCcNs, "Work")
+}
+
+// checkMetadataStructure verifies the scaffold the other metadata checks
+// rely on: a metadata element holding an rdf:RDF block with a cc:Work that
+// contains the Dublin Core elements. Dublin Core elements found anywhere
+// else, outside of a cc:Agent, are reported as stray.
+func checkMetadataStructure(c *collector, path string, node *xmlquery.Node) {
+	var work *xmlquery.Node
+
+	metadata := xmlquery.FindOne(node, nsQuery(svgNs, "metadata"))
+	if metadata == nil {
+		c.add(path, "checkMetadataStructure", SeverityWarning, "Metadata missing")
+	} else if rdf := childElement(metadata, svgRdfNs, "RDF"); rdf == nil {
+		c.add(path, "checkMetadataStructure", SeverityWarning, "Metadata has no rdf:RDF block")
+	} else if work = childElement(rdf, svgCcNs, "Work"); work == nil {
+		c.add(path, "checkMetadataStructure", SeverityWarning, "Metadata rdf:RDF block has no cc:Work")
+	}
+
+	found := 0
+	stray := 0
+	for _, n := range xmlquery.Find(node, fmt.Sprintf("//*[namespace-uri()=%q]", svgDcNs)) {
+		parent := n.Parent
+		if parent != nil && parent.NamespaceURI == svgCcNs && parent.Data == "Agent" {
+			continue
+		}
+		if work != nil && parent == work {
+			found++
+		} else if parent == nil || parent.NamespaceURI != svgDcNs {
+			stray++
+		}
+	}
+
+	if work != nil && found == 0 {
+		c.add(path, "checkMetadataStructure", SeverityWarning, "Metadata cc:Work has no Dublin Core elements")
+	}
+	if stray > 0 {
+		c.add(path, "checkMetadataStructure", SeverityWarning, "%d Dublin Core element(s) outside the metadata cc:Work", stray)
+	}
+}
+
+// getStyleValues returns the values given to a presentation property on n,
+// both as an attribute and as a declaration in its style attribute.
+func getStyleValues(n *xmlquery.Node, property string) []string {
+	var values []string
+
+	if v := strings.TrimSpace(n.SelectAttr(property)); v != "" {
+		values = append(values, v)
+	}
+
+	for _, decl := range strings.Split(n.SelectAttr("style"), ";") {
+		parts := strings.SplitN(decl, ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == property {
+			if v := strings.TrimSpace(parts[1]); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values
+}
+
+// checkFonts reports font families that aren't in the Fonts list. Each
+// family in a font stack is checked separately.
+func checkFonts(c *collector, path string, node *xmlquery.Node) {
+	if len(c.opts.Fonts) == 0 {
+		return
+	}
+
+	allowed := make(map[string]bool)
+	for _, font := range c.opts.Fonts {
+		allowed[strings.ToLower(strings.Trim(strings.TrimSpace(font), `'"`))] = true
+	}
+
+	reported := make(map[string]bool)
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*")
+	for _, n := range nodes {
+		for _, value := range getStyleValues(n, "font-family") {
+			for _, family := range strings.Split(value, ",") {
+				family = strings.Trim(strings.TrimSpace(family), `'"`)
+				key := strings.ToLower(family)
+				if family == "" || allowed[key] || reported[key] {
+					continue
+				}
+				reported[key] = true
+				c.add(path, "checkFonts", SeverityWarning, "Font family %q is not allowed", family)
+			}
+		}
+	}
+}
+
+// countElements returns the number of element nodes in the tree below and
+// including node.
+func countElements(node *xmlquery.Node) int {
+	count := 0
+	if node.Type == xmlquery.ElementNode {
+		count++
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		count += countElements(child)
+	}
+
+	return count
+}
+
+// formatBytes returns size in bytes in a readable form, such as 1.5 MB.
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
+// checkFileSize warns about files larger than MaxBytes. The size is that of
+// the file as stored, so a .svgz file is measured compressed. Documents
+// that weren't read from a file, such as stdin, are skipped.
+func checkFileSize(c *collector, path string, node *xmlquery.Node) {
+	if c.opts.MaxBytes == 0 || !isSvgPath(path) {
+		return
+	}
+
+	size, err := getFileSize(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkFileSize\tERROR\t%v\n", err)
+		return
+	}
+	if size > int64(c.opts.MaxBytes) {
+		c.add(path, "checkFileSize", SeverityWarning, "File is too large (%s), the maximum is %d bytes", formatBytes(size), c.opts.MaxBytes)
+	}
+}
+
+// checkComplexity warns about tiles with more elements than MaxNodes,
+// which are usually the result of a bad export and slow to render.
+func checkComplexity(c *collector, path string, node *xmlquery.Node) {
+	if c.opts.MaxNodes == 0 {
+		return
+	}
+
+	if count := countElements(node); count > c.opts.MaxNodes {
+		c.add(path, "checkComplexity", SeverityWarning, "Too many elements (%d), the maximum is %d", count, c.opts.MaxNodes)
+	}
+}
+
+// coordinateRe matches a single number in path data or a points list. The
+// fraction is captured so its length can be measured.
+var coordinateRe = regexp.MustCompile(`[+-]?(?:\d*\.(\d+)|\d+\.?)(?:[eE][+-]?\d+)?`)
+
+// checkPrecision counts the coordinates in path data and polygon or
+// polyline points that have more than MaxPrecision decimal places.
+func checkPrecision(c *collector, path string, node *xmlquery.Node) {
+	count := 0
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//path")
+	for _, n := range nodes {
+		for _, m := range coordinateRe.FindAllStringSubmatch(n.SelectAttr("d"), -1) {
+			if len(m[1]) > c.opts.MaxPrecision {
+				count++
+			}
+		}
+	}
+
+	nodes = xmlquery.Find(node, "//polygon | //polyline")
+	for _, n := range nodes {
+		for _, m := range coordinateRe.FindAllStringSubmatch(n.SelectAttr("points"), -1) {
+			if len(m[1]) > c.opts.MaxPrecision {
+				count++
+			}
+		}
+	}
+
+	if count > 0 {
+		c.add(path, "checkPrecision", SeverityWarning, "%d coordinates have more than %d decimal places", count, c.opts.MaxPrecision)
+	}
+}
+
+// checkStrokeWidth reports stroke widths narrower than MinStroke px, which
+// disappear when tiles are rendered small. Widths given as a percentage or
+// in another relative unit can't be converted to px and are skipped, as are
+// zero widths, which turn the stroke off.
+func checkStrokeWidth(c *collector, path string, node *xmlquery.Node) {
+	if c.opts.MinStroke == 0 {
+		return
+	}
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*")
+	for _, n := range nodes {
+		for _, value := range getStyleValues(n, "stroke-width") {
+			if isRelativeUnit(value) || !strings.ContainsAny(value[:1], "0123456789.") {
+				continue
+			}
+
+			width := toFloat(value) * getUnitConversion(value)
+			if width > 0 && width < c.opts.MinStroke {
+				c.add(path, "checkStrokeWidth", SeverityWarning, "Stroke width %q on <%s> is below the minimum of %gpx", value, n.Data, c.opts.MinStroke)
+			}
+		}
+	}
+}
+
+// shapeDimensions lists the attributes of each shape element that must be
+// positive for it to cover any area.
+var shapeDimensions = map[string][]string{
+	"rect":    {"width", "height"},
+	"circle":  {"r"},
+	"ellipse": {"rx", "ry"},
+}
+
+// shapeLength returns the value of the geometry attribute name on n, which
+// defaults to 0 when missing. ok is false if the value can't be known
+// without applying CSS, because it is set in a style or the attribute is
+// missing from an element with a class, or isn't a number.
+func shapeLength(n *xmlquery.Node, name string) (value float64, ok bool) {
+	attr := strings.TrimSpace(n.SelectAttr(name))
+	if attr == "" {
+		if len(getStyleValues(n, name)) > 0 || n.SelectAttr("class") != "" {
+			return 0, false
+		}
+		return 0, true
+	}
+
+	if !strings.ContainsAny(attr[:1], "+-0123456789.") {
+		return 0, false
+	}
+
+	return toFloat(attr), true
+}
+
+// checkZeroArea reports rect, circle and ellipse elements with a zero or
+// negative size and lines of zero length, none of which are drawn.
+func checkZeroArea(c *collector, path string, node *xmlquery.Node) {
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//rect | //circle | //ellipse")
+	for _, n := range nodes {
+		for _, name := range shapeDimensions[n.Data] {
+			if v, ok := shapeLength(n, name); ok && v <= 0 {
+				c.add(path, "checkZeroArea", SeverityWarning, "<%s> isn't drawn, %s is %g", n.Data, name, v)
+				break
+			}
+		}
+	}
+
+	nodes = xmlquery.Find(node, "//line")
+	for _, n := range nodes {
+		x1, ok1 := shapeLength(n, "x1")
+		y1, ok2 := shapeLength(n, "y1")
+		x2, ok3 := shapeLength(n, "x2")
+		y2, ok4 := shapeLength(n, "y2")
+		if ok1 && ok2 && ok3 && ok4 && x1 == x2 && y1 == y2 {
+			c.add(path, "checkZeroArea", SeverityWarning, "<line> isn't drawn, its length is 0")
+		}
+	}
+}
+
+// cssCommentRe matches a CSS comment.
+var cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// cssPreludeRe matches the text before a { in a style sheet, which is the
+// selector of a rule or the condition of an at-rule such as @media.
+var cssPreludeRe = regexp.MustCompile(`([^{}]*)\{`)
+
+// cssClassRe matches a class selector.
+var cssClassRe = regexp.MustCompile(`\.(-?[_a-zA-Z][_a-zA-Z0-9-]*)`)
+
+// checkStyleClasses cross references the classes defined in style elements
+// with those used in class attributes, warning about classes that are
+// defined but never used and used but never defined. Only simple .name
+// selectors are understood. Tiles without a style element are skipped,
+// their classes may be meant for a style sheet elsewhere.
+func checkStyleClasses(c *collector, path string, node *xmlquery.Node) {
+	var styles []*xmlquery.Node
+	styles = xmlquery.Find(node, "//style")
+	if len(styles) == 0 {
+		return
+	}
+
+	defined := make(map[string]bool)
+	for _, n := range styles {
+		css := cssCommentRe.ReplaceAllString(n.InnerText(), "")
+		for _, prelude := range cssPreludeRe.FindAllStringSubmatch(css, -1) {
+			if strings.HasPrefix(strings.TrimSpace(prelude[1]), "@") {
+				continue
+			}
+			for _, m := range cssClassRe.FindAllStringSubmatch(prelude[1], -1) {
+				defined[m[1]] = true
+			}
+		}
+	}
+
+	used := make(map[string]bool)
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*[@class]")
+	for _, n := range nodes {
+		for _, class := range strings.Fields(n.SelectAttr("class")) {
+			used[class] = true
+		}
+	}
+
+	var unused, undefined []string
+	for class := range defined {
+		if !used[class] {
+			unused = append(unused, class)
+		}
+	}
+	for class := range used {
+		if !defined[class] {
+			undefined = append(undefined, class)
+		}
+	}
+	sort.Strings(unused)
+	sort.Strings(undefined)
+
+	for _, class := range unused {
+		c.add(path, "checkStyleClasses", SeverityWarning, "Class %q is defined in <style> but never used", class)
+	}
+	for _, class := range undefined {
+		c.add(path, "checkStyleClasses", SeverityWarning, "Class %q is used but not defined in <style>", class)
+	}
+}
+
+// urlRefRe matches a url(#id) reference in an attribute or style sheet.
+var urlRefRe = regexp.MustCompile(`url\(\s*['"]?#([^'")\s]+)`)
+
+// checkUnusedDefs reports each definition in <defs>, such as a gradient,
+// filter or symbol, whose id isn't referenced anywhere in the document by
+// url(#id) or href="#id".
+func checkUnusedDefs(c *collector, path string, node *xmlquery.Node) {
+	var defs []*xmlquery.Node
+	defs = xmlquery.Find(node, "//defs/*[@id]")
+	if len(defs) == 0 {
+		return
+	}
+
+	used := make(map[string]bool)
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*")
+	for _, n := range nodes {
+		for _, attr := range n.Attr {
+			if attr.Name.Local == "href" && strings.HasPrefix(strings.TrimSpace(attr.Value), "#") {
+				used[strings.TrimPrefix(strings.TrimSpace(attr.Value), "#")] = true
+			}
+			for _, m := range urlRefRe.FindAllStringSubmatch(attr.Value, -1) {
+				used[m[1]] = true
+			}
+		}
+		if n.Data == "style" {
+			for _, m := range urlRefRe.FindAllStringSubmatch(n.InnerText(), -1) {
+				used[m[1]] = true
+			}
+		}
+	}
+
+	for _, n := range defs {
+		id := n.SelectAttr("id")
+		if !used[id] {
+			c.add(path, "checkUnusedDefs", SeverityWarning, "<%s id=%q> in <defs> is never used", n.Data, id)
+		}
+	}
+}
+
+// checkDuplicateIds reports id attribute values used by more than one
+// element.
+func checkDuplicateIds(c *collector, path string, node *xmlquery.Node) {
+	counts := make(map[string]int)
+	var duplicates []string
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*[@id]")
+	for _, n := range nodes {
+		id := n.SelectAttr("id")
+		counts[id]++
+		if counts[id] == 2 {
+			duplicates = append(duplicates, id)
+		}
+	}
+
+	if len(duplicates) > 0 {
+		c.add(path, "checkDuplicateIds", SeverityError, "Duplicate ids: %s", strings.Join(duplicates, ", "))
+	}
+}
+
+// isEmptyGroup reports whether n is a group with nothing in it but
+// whitespace, comments and other empty groups.
+func isEmptyGroup(n *xmlquery.Node) bool {
+	if n.Type != xmlquery.ElementNode || n.Data != "g" || n.NamespaceURI != svgNs {
+		return false
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case xmlquery.ElementNode:
+			if !isEmptyGroup(child) {
+				return false
+			}
+		case xmlquery.TextNode, xmlquery.CharDataNode:
+			if strings.TrimSpace(child.Data) != "" {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// checkEmptyGroups counts the groups that contain nothing but whitespace and
+// other empty groups, which editors tend to leave behind. Nested empty
+// groups are counted individually.
+func checkEmptyGroups(c *collector, path string, node *xmlquery.Node) {
+	count := 0
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//g")
+	for _, n := range nodes {
+		if isEmptyGroup(n) {
+			count++
+		}
+	}
+
+	if count > 0 {
+		c.add(path, "checkEmptyGroups", SeverityWarning, "Contains %d empty group(s)", count)
+	}
+}
+
+// checkEditorMetadata counts the elements and attributes that belong to one
+// of the EditorNamespaces. These are left behind by editors such as
+// Inkscape and Illustrator and aren't needed in production tiles.
+func checkEditorMetadata(c *collector, path string, node *xmlquery.Node) {
+	elements := 0
+	attributes := 0
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//*")
+	for _, n := range nodes {
+		if c.editorNs[n.NamespaceURI] {
+			elements++
+		}
+		for _, attr := range n.Attr {
+			if c.editorNs[attr.NamespaceURI] {
+				attributes++
+			}
+		}
+	}
+
+	if elements > 0 || attributes > 0 {
+		c.add(path, "checkEditorMetadata", SeverityWarning, "Editor metadata in %d elements and %d attributes, consider running it through an SVG optimizer", elements, attributes)
+	}
+}
+
+// metadataPrefixes maps the prefixes conventionally used in tile metadata
+// to the namespaces they must be bound to.
+var metadataPrefixes = map[string]string{
+	"cc":  svgCcNs,
+	"dc":  svgDcNs,
+	"rdf": svgRdfNs,
+}
+
+// checkNamespace verifies that the root element is in the SVG namespace, as
+// browsers won't render it as SVG otherwise, and that the dc, cc and rdf
+// prefixes are bound to the right namespaces. A prefix that isn't declared
+// at all already fails to parse.
+func checkNamespace(c *collector, path string, node *xmlquery.Node) {
+	root := node.FirstChild
+	for root != nil && root.Type != xmlquery.ElementNode {
+		root = root.NextSibling
+	}
+	if root == nil {
+		return
+	}
+
+	if root.NamespaceURI != svgNs {
+		if root.NamespaceURI == "" {
+			c.add(path, "checkNamespace", SeverityWarning, "Root element doesn't declare the SVG namespace %q", svgNs)
+		} else {
+			c.add(path, "checkNamespace", SeverityWarning, "Root element is in the namespace %q instead of %q", root.NamespaceURI, svgNs)
+		}
+	}
+
+	wrong := make(map[string]string)
+	for _, n := range xmlquery.Find(node, "//*") {
+		if ns, ok := metadataPrefixes[n.Prefix]; ok && n.NamespaceURI != ns {
+			wrong[n.Prefix] = n.NamespaceURI
+		}
+		for _, attr := range n.Attr {
+			if ns, ok := metadataPrefixes[attr.Name.Space]; ok && attr.NamespaceURI != ns {
+				wrong[attr.Name.Space] = attr.NamespaceURI
+			}
+		}
+	}
+
+	var prefixes []string
+	for prefix := range wrong {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		c.add(path, "checkNamespace", SeverityWarning, "Prefix %q is bound to %q instead of %q", prefix, wrong[prefix], metadataPrefixes[prefix])
+	}
+}
+
+// checkEncoding inspects the start of the raw file, since the parser both
+// skips a byte order mark and makes up a declaration when there isn't one.
+// The file must start with an XML declaration, without a byte order mark,
+// and any encoding it declares must be UTF-8.
+func checkEncoding(c *collector, path string, node *xmlquery.Node) {
+	head := c.head
+	switch {
+	case bytes.HasPrefix(head, []byte{0xef, 0xbb, 0xbf}):
+		c.add(path, "checkEncoding", SeverityWarning, "Starts with a UTF-8 byte order mark")
+		head = head[3:]
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}), bytes.HasPrefix(head, []byte{0xff, 0xfe}):
+		c.add(path, "checkEncoding", SeverityWarning, "Starts with a UTF-16 byte order mark, the file should be encoded as UTF-8")
+		return
+	}
+
+	if !bytes.HasPrefix(head, []byte("<?xml")) || len(head) < 6 || !isXMLSpace(head[5]) {
+		c.add(path, "checkEncoding", SeverityWarning, "Missing XML declaration")
+		return
+	}
+
+	var decl *xmlquery.Node
+	for n := node.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type == xmlquery.DeclarationNode && n.Data == "xml" {
+			decl = n
+			break
+		}
+	}
+	if decl == nil {
+		return
+	}
+
+	encoding := decl.SelectAttr("encoding")
+	if encoding != "" && !strings.EqualFold(encoding, "UTF-8") && !strings.EqualFold(encoding, "UTF8") {
+		c.add(path, "checkEncoding", SeverityWarning, "Declared encoding %q is not UTF-8", encoding)
+	}
+}
+
+func isXMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
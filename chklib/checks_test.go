@@ -0,0 +1,126 @@
+package chklib
+
+import (
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"-40", -40},
+		{"1.5e2", 150},
+		{"+3.0", 3},
+		{"120", 120},
+		{".5", 0.5},
+		{"-1.5e2px", -150},
+		{" 53.445831mm ", 53.445831},
+		{"2E-1", 0.2},
+		// Malformed values are reported and converted to 0.
+		{"abc", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := toFloat(tt.value); got != tt.want {
+			t.Errorf("toFloat(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// toFloatUncompiled is toFloat as it was before numberRe, compiling the
+// regular expression on every call, for comparison in BenchmarkToFloat.
+func toFloatUncompiled(s string) float64 {
+	re := regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+	f, _ := strconv.ParseFloat(re.FindString(strings.TrimSpace(s)), 64)
+	return f
+}
+
+func BenchmarkToFloat(b *testing.B) {
+	values := []string{"120", "-1.5e2px", " 53.445831mm ", "100%"}
+
+	b.Run("uncompiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toFloatUncompiled(values[i%len(values)])
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			toFloat(values[i%len(values)])
+		}
+	})
+}
+
+func TestUnitConversion(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"120", 1, false},
+		{"120px", 1, false},
+		{"1in", 96, false},
+		{"10mm", 3.7795275590, false},
+		{"10cm", 37.795275590, false},
+		{"1m", 3779.5275590, false},
+		{"12pt", 1.3333333333, false},
+		{"1pc", 16, false},
+		{"100%", 0, true},
+		{"2em", 0, true},
+		{"2ex", 0, true},
+		{"10q", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := unitConversion(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unitConversion(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("unitConversion(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := unitConversion("10q"); err == nil || err.Error() != `unknown unit "q"` {
+		t.Errorf("unitConversion(%q) error = %v, want unknown unit \"q\"", "10q", err)
+	}
+}
+
+// TestTitleMatch checks that the dc:title naming the creator is never taken
+// for the title of the tile.
+func TestTitleMatch(t *testing.T) {
+	fixture := "../test-data/title-match-creator.svg"
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"creator first", fixture, 0},
+		{"no work title", writeFile(t, dir, "untitled.svg", strings.Replace(string(data), "<dc:title>Square</dc:title>", "", 1)), 0},
+		{"mismatch", writeFile(t, dir, "mismatch.svg", strings.Replace(string(data), "<dc:title>Square</dc:title>", "<dc:title>Box</dc:title>", 1)), 1},
+	}
+
+	for _, tt := range tests {
+		results, err := CheckFile(tt.path, testOptions("title-match"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("%s: got %v, want %d result(s)", tt.name, results, tt.want)
+		}
+	}
+}
@@ -0,0 +1,920 @@
+// Package chklib checks SVG tiles for missing metadata, bad dimensions,
+// misspellings, duplicates and other problems. It implements the checks run
+// by the chktiles command so that they can also be used from other programs.
+package chklib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/trustmaster/go-aspell"
+)
+
+const SeverityError = "ERROR"
+const SeverityWarning = "WARNING"
+
+// Result describes a single problem found by one of the checks.
+type Result struct {
+	Path     string `json:"path"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+
+	// Duplicate and Match are only set by the duplicates check, to the path
+	// of the matching file relative to the duplicate directory and a comma
+	// separated list of the ways it matched: name, size, content or
+	// structure.
+	Duplicate string `json:"duplicate,omitempty"`
+	Match     string `json:"match,omitempty"`
+
+	// Words is only set by the spelling checks, to the misspelled words.
+	Words []string `json:"words,omitempty"`
+}
+
+// Options control which checks are run and how strict they are. Use
+// DefaultOptions to get the settings chktiles uses when no flags are given.
+type Options struct {
+	// Checks lists the names of the checks to run, or all of them if it is
+	// empty. Skip lists checks not to run. See CheckNames.
+	Checks []string
+	Skip   []string
+
+	// Severity overrides the severity of every result reported by a check,
+	// keyed by check name, e.g. {"units": SeverityError}. The levels are
+	// SeverityError and SeverityWarning, in any case.
+	Severity map[string]string
+
+	// MinKeywords is the number of non-empty keywords a tile should have,
+	// fewer is a warning. 0 only requires the keywords to be present.
+	MinKeywords int
+
+	// Verbose prints each file as it is checked and reports every kind of
+	// duplicate separately.
+	Verbose bool
+
+	// MinWidth and MinHeight are the smallest tile size allowed in px, 0
+	// disables the size check.
+	MinWidth  int
+	MinHeight int
+
+	// Lang lists the aspell dictionaries used by the spelling checks, a word
+	// is correct if any of them accept it. If SpellingOptional is set a
+	// dictionary that can't be loaded disables the spelling checks with a
+	// warning instead of being an error.
+	Lang             []string
+	SpellingOptional bool
+
+	// NoSpelling turns off all of the spelling checks, so that aspell isn't
+	// needed at all.
+	NoSpelling bool
+
+	// AllowWordsFile names a file of words, one per line, that are never
+	// reported as misspelled.
+	AllowWordsFile string
+
+	// Jobs is the number of files checked in parallel.
+	Jobs int
+
+	// Hash is the algorithm used to compare file content, md5 or sha256.
+	Hash string
+
+	// Cache names a file in which the hashes of the files compared for
+	// duplicates are kept between runs, it is not used if empty. A cached
+	// hash is used as long as the file's modification time and size haven't
+	// changed.
+	Cache string
+
+	// StructuralDup also compares the structure of the tiles, so that tiles
+	// which only differ in their metadata, whitespace, attribute order or
+	// ids are reported as duplicates.
+	StructuralDup bool
+
+	// Aspect is the required aspect ratio, such as "4:3", or "any".
+	Aspect string
+
+	// MaxBytes is the largest file size allowed for a tile, 0 disables the
+	// file size check.
+	MaxBytes int
+
+	// MaxImageBytes is the size above which embedded raster images are
+	// reported.
+	MaxImageBytes int
+
+	// RequireLicense is the cc:license URL every tile must declare, if set.
+	RequireLicense string
+
+	// Fonts lists the font families tiles may use, any font is allowed if it
+	// is empty.
+	Fonts []string
+
+	// PaletteFile names a file of the colors tiles may use for fills and
+	// strokes, one per line. Any color is allowed if it is empty.
+	PaletteFile string
+
+	// MaxNodes is the maximum number of elements in a tile, 0 disables the
+	// complexity check.
+	MaxNodes int
+
+	// MaxPrecision is the maximum number of decimal places in path and
+	// polygon coordinates.
+	MaxPrecision int
+
+	// MinStroke is the narrowest stroke width allowed in px, 0 disables the
+	// stroke width check.
+	MinStroke float64
+
+	// EditorNamespaces lists the namespace URIs of editor metadata that
+	// should be stripped from tiles.
+	EditorNamespaces []string
+
+	// Exclude lists glob patterns of paths to skip when walking directories.
+	Exclude []string
+
+	// Include, if not empty, lists glob patterns of the files to check when
+	// walking directories, any other file is skipped. Exclude takes
+	// precedence, so a file matching both is skipped. Include doesn't apply
+	// to the duplicate directory or to files named directly.
+	Include []string
+
+	// FollowSymlinks descends into symbolic links to directories when
+	// walking, which is not done by default. Each directory is only walked
+	// once, however many links lead to it.
+	FollowSymlinks bool
+
+	// MaxDepth limits how many directories deep the walks descend, 0 only
+	// checks the files in the top directory and -1 has no limit.
+	MaxDepth int
+
+	// FailFast stops checking further files as soon as an error is found.
+	// The files already being checked are finished, so the results hold
+	// the error and possibly a few more. Warnings don't stop the checks.
+	FailFast bool
+
+	// OnFile, if not nil, is called with the path of each file checked,
+	// including those that can't be opened or parsed. It may be called
+	// from several goroutines at once.
+	OnFile func(path string)
+
+	// OnTile, if not nil, is called with a description of each file that
+	// could be parsed, for building a catalog of the tiles. It may be
+	// called from several goroutines at once.
+	OnTile func(tile Tile)
+
+	// OnCheck, if not nil, is called after each check has been run on a
+	// file with the name of the check and the time it took. It may be
+	// called from several goroutines at once.
+	OnCheck func(name string, elapsed time.Duration)
+
+	// Progress, if not nil, is called after each file has been checked with
+	// the number of files checked so far and the number there are to check.
+	// It is never called from more than one goroutine at a time.
+	Progress func(done int, total int)
+}
+
+// DefaultOptions returns the options used by chktiles when no flags are
+// given.
+func DefaultOptions() Options {
+	return Options{
+		MinWidth:         80,
+		MinHeight:        80,
+		Lang:             []string{"en_US"},
+		SpellingOptional: true,
+		Jobs:             runtime.NumCPU(),
+		Hash:             "md5",
+		Aspect:           "any",
+		MaxNodes:         10000,
+		MaxPrecision:     3,
+		MinStroke:        0.5,
+		EditorNamespaces: []string{sodipodiNs, inkscapeNs, illustratorNs, adobeExtensionsNs},
+		MaxDepth:         -1,
+	}
+}
+
+// Validate reports the first problem with opts, such as an unknown check
+// name or a negative size.
+func (opts Options) Validate() error {
+	_, err := newChecker(opts)
+	return err
+}
+
+// SelectedChecks returns the names of the checks opts select, in the order
+// they are run.
+func (opts Options) SelectedChecks() ([]string, error) {
+	k, err := newChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, chk := range k.checks {
+		names = append(names, chk.name)
+	}
+	return names, nil
+}
+
+// checker holds the state shared by every file checked in one run. It is
+// created from the Options by newChecker.
+type checker struct {
+	opts        Options
+	checks      []tileCheck
+	aspectRatio float64
+	exclude     []globPattern
+	include     []globPattern
+	editorNs    map[string]bool
+	severity    map[string]string
+	dups        *dupIndex
+
+	// spellers are shared by the spelling checks, one per language. It is
+	// empty when aspell could not be initialized, in which case the spelling
+	// checks do nothing.
+	spellers []aspell.Speller
+
+	// allowedWords holds the lower cased words from AllowWordsFile which are
+	// never reported as misspelled.
+	allowedWords map[string]bool
+
+	// palette holds the normalized hex colors from PaletteFile, or is nil
+	// if there is no palette.
+	palette map[string]bool
+
+	// spellMu serializes use of the spellers, which are not safe for
+	// concurrent use, between the workers.
+	spellMu sync.Mutex
+}
+
+// newChecker validates opts and converts them to the form used by the
+// checks. It doesn't load any files, see open.
+func newChecker(opts Options) (*checker, error) {
+	if opts.MinWidth < 0 || opts.MinHeight < 0 {
+		return nil, fmt.Errorf("the minimum width and height must not be negative")
+	}
+
+	if opts.Jobs < 1 {
+		return nil, fmt.Errorf("the number of jobs must be at least 1")
+	}
+
+	if _, ok := hashAlgorithms[opts.Hash]; !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %q, use md5 or sha256", opts.Hash)
+	}
+
+	if opts.MaxBytes < 0 || opts.MaxImageBytes < 0 || opts.MaxNodes < 0 || opts.MaxPrecision < 0 {
+		return nil, fmt.Errorf("the maximum bytes, image bytes, nodes and precision must not be negative")
+	}
+
+	if opts.MinKeywords < 0 {
+		return nil, fmt.Errorf("the minimum number of keywords must not be negative")
+	}
+
+	if opts.MinStroke < 0 {
+		return nil, fmt.Errorf("the minimum stroke width must not be negative")
+	}
+
+	if opts.MaxDepth < -1 {
+		return nil, fmt.Errorf("the maximum depth must be -1 or more")
+	}
+
+	k := &checker{opts: opts, editorNs: make(map[string]bool), allowedWords: make(map[string]bool)}
+
+	for _, ns := range opts.EditorNamespaces {
+		k.editorNs[strings.TrimSpace(ns)] = true
+	}
+
+	ratio, err := parseAspect(opts.Aspect)
+	if err != nil {
+		return nil, err
+	}
+	k.aspectRatio = ratio
+
+	for _, pattern := range opts.Exclude {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		k.exclude = append(k.exclude, g)
+	}
+
+	for _, pattern := range opts.Include {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		k.include = append(k.include, g)
+	}
+
+	k.checks, err = selectChecks(opts.Checks, opts.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	k.severity, err = checkSeverities(opts.Severity)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.NoSpelling {
+		var checks []tileCheck
+		for _, chk := range k.checks {
+			if !spellingChecks[chk.name] {
+				checks = append(checks, chk)
+			}
+		}
+		k.checks = checks
+	}
+
+	return k, nil
+}
+
+// open loads the allowed words, the palette and the spelling dictionaries.
+// close must be called once the checker is no longer needed.
+func (k *checker) open() error {
+	if k.opts.PaletteFile != "" {
+		if err := k.loadPalette(k.opts.PaletteFile); err != nil {
+			return fmt.Errorf("unable to load the palette, %v", err)
+		}
+	}
+
+	if k.opts.AllowWordsFile != "" {
+		if err := k.loadAllowedWords(k.opts.AllowWordsFile); err != nil {
+			return fmt.Errorf("unable to load allowed words, %v", err)
+		}
+	}
+
+	return k.newSpellers()
+}
+
+func (k *checker) close() {
+	k.deleteSpellers()
+}
+
+// collector accumulates the results reported by the checks so that the
+// presentation can be done in one place once the walk is complete.
+type collector struct {
+	*checker
+	results []Result
+
+	// head holds the first bytes of the document being checked, before it
+	// was parsed, for the checks that need to see the raw file.
+	head []byte
+}
+
+func (c *collector) add(path string, check string, severity string, format string, args ...interface{}) {
+	c.addResult(Result{Path: path, Check: check, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// addResult records r, for the checks that fill in more than add does. Every
+// result goes through here so that the Severity option applies to all of
+// them.
+func (c *collector) addResult(r Result) {
+	if s, ok := c.severity[r.Check]; ok {
+		r.Severity = s
+	}
+	c.results = append(c.results, r)
+}
+
+// tileCheck associates the name used to select a check with the function
+// that implements it. id is the name reported in Result.Check.
+type tileCheck struct {
+	name        string
+	id          string
+	fn          func(c *collector, path string, node *xmlquery.Node)
+	description string
+}
+
+// checks lists every available check in the order they are run.
+var checks = []tileCheck{
+	{"metadata-structure", "checkMetadataStructure", checkMetadataStructure, "The metadata has an rdf:RDF block with a cc:Work"},
+	{"keywords", "checkKeywords", checkKeywords, "The metadata lists keywords"},
+	{"size", "checkSize", checkSize, "The tile is at least the minimum width and height"},
+	{"units", "checkUnits", checkUnits, "The width and height are given in px"},
+	{"identifier", "checkIdentifier", checkIdentifier, "The dc:identifier is present and matches the file name"},
+	{"creator", "checkCreator", checkCreator, "The metadata names the creator"},
+	{"title", "checkTitle", checkTitle, "The tile has a title"},
+	{"title-match", "checkTitleMatch", checkTitleMatch, "The title agrees with the dc:title metadata"},
+	{"description", "checkDescription", checkDescription, "The tile has a description"},
+	{"viewbox", "checkViewBox", checkViewBox, "The viewBox is well formed and agrees with the width and height"},
+	{"viewbox-present", "checkViewBoxPresent", checkViewBoxPresent, "The tile has a viewBox, or a width and height to infer one from"},
+	{"aspect-ratio", "checkAspectRatio", checkAspectRatio, "The tile has the required aspect ratio"},
+	{"file-size", "checkFileSize", checkFileSize, "The file is no larger than allowed"},
+	{"embedded-images", "checkEmbeddedImages", checkEmbeddedImages, "Embedded raster images are no larger than allowed"},
+	{"external-refs", "checkExternalRefs", checkExternalRefs, "Nothing outside the tile is referenced"},
+	{"scripts", "checkScripts", checkScripts, "The tile contains no scripts or event handlers"},
+	{"foreign-objects", "checkForeignObjects", checkForeignObjects, "The tile contains no foreignObject elements"},
+	{"license", "checkLicense", checkLicense, "The metadata declares a license"},
+	{"fonts", "checkFonts", checkFonts, "Only the allowed font families are used"},
+	{"colors", "checkColors", checkColors, "Fills and strokes only use colors from the palette"},
+	{"complexity", "checkComplexity", checkComplexity, "The tile doesn't have too many elements"},
+	{"precision", "checkPrecision", checkPrecision, "Coordinates don't have too many decimal places"},
+	{"stroke-width", "checkStrokeWidth", checkStrokeWidth, "Strokes are at least the minimum width"},
+	{"zero-area", "checkZeroArea", checkZeroArea, "Shapes have a positive size"},
+	{"style-classes", "checkStyleClasses", checkStyleClasses, "The classes in style elements and class attributes match"},
+	{"unused-defs", "checkUnusedDefs", checkUnusedDefs, "Everything in <defs> is referenced by url(#id) or href"},
+	{"duplicate-ids", "checkDuplicateIds", checkDuplicateIds, "Element ids are unique"},
+	{"empty-groups", "checkEmptyGroups", checkEmptyGroups, "The tile has no empty groups"},
+	{"editor-metadata", "checkEditorMetadata", checkEditorMetadata, "Editor metadata has been stripped"},
+	{"namespace", "checkNamespace", checkNamespace, "The tile is in the SVG namespace and the metadata prefixes are bound correctly"},
+	{"encoding", "checkEncoding", checkEncoding, "The file starts with an XML declaration and is encoded as UTF-8"},
+	{"keyword-spelling", "checkKeywordSpelling", checkKeywordSpelling, "The keywords are spelled correctly"},
+	{"text-spelling", "checkTspanSpelling", checkTspanSpelling, "The visible text is spelled correctly"},
+	{"title-spelling", "checkTitleSpelling", checkTitleSpelling, "The title and description are spelled correctly"},
+	{"metadata-spelling", "checkMetadataSpelling", checkMetadataSpelling, "The metadata title and description are spelled correctly"},
+	{"duplicates", "checkDuplicates", checkDuplicates, "The tile isn't a duplicate of one in the duplicate directory"},
+}
+
+// CheckNames returns the names of every available check in the order they
+// are run.
+func CheckNames() []string {
+	var names []string
+	for _, chk := range checks {
+		names = append(names, chk.name)
+	}
+	return names
+}
+
+// CheckInfo describes one of the available checks.
+type CheckInfo struct {
+	// Name is used to select the check in Options.Checks and Options.Skip.
+	Name string
+	// ID is the value of Result.Check in the results it reports.
+	ID          string
+	Description string
+}
+
+// Checks describes every available check in the order they are run.
+func Checks() []CheckInfo {
+	var infos []CheckInfo
+	for _, chk := range checks {
+		infos = append(infos, CheckInfo{chk.name, chk.id, chk.description})
+	}
+	return infos
+}
+
+func findCheck(name string) (tileCheck, bool) {
+	for _, chk := range checks {
+		if chk.name == name {
+			return chk, true
+		}
+	}
+	return tileCheck{}, false
+}
+
+// isActive reports whether the check called name will be run.
+func (k *checker) isActive(name string) bool {
+	for _, chk := range k.checks {
+		if chk.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSeverities converts the Severity option, keyed by check name, to a
+// map keyed by the id the check reports its results under.
+func checkSeverities(levels map[string]string) (map[string]string, error) {
+	severity := make(map[string]string)
+	for name, level := range levels {
+		chk, ok := findCheck(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown check %q, valid checks are: %s", name, strings.Join(CheckNames(), ", "))
+		}
+
+		switch strings.ToUpper(strings.TrimSpace(level)) {
+		case SeverityError:
+			severity[chk.id] = SeverityError
+		case SeverityWarning:
+			severity[chk.id] = SeverityWarning
+		default:
+			return nil, fmt.Errorf("unknown severity %q for check %q, use error or warning", level, name)
+		}
+	}
+	return severity, nil
+}
+
+// selectChecks returns the checks named in only, or every check if only is
+// empty, leaving out those named in skip. The checks are returned in
+// registry order. It is an error for any of the names to be unknown.
+func selectChecks(only []string, skip []string) ([]tileCheck, error) {
+	wanted := make(map[string]bool)
+	for _, name := range only {
+		name = strings.TrimSpace(name)
+		if _, ok := findCheck(name); !ok {
+			return nil, fmt.Errorf("unknown check %q, valid checks are: %s", name, strings.Join(CheckNames(), ", "))
+		}
+		wanted[name] = true
+	}
+
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		name = strings.TrimSpace(name)
+		if _, ok := findCheck(name); !ok {
+			return nil, fmt.Errorf("unknown check %q, valid checks are: %s", name, strings.Join(CheckNames(), ", "))
+		}
+		skipped[name] = true
+	}
+
+	var selected []tileCheck
+	for _, chk := range checks {
+		if (len(only) == 0 || wanted[chk.name]) && !skipped[chk.name] {
+			selected = append(selected, chk)
+		}
+	}
+	return selected, nil
+}
+
+// disableDirective starts an XML comment that turns off checks for the file
+// it appears in, e.g. <!-- chktiles:disable size,keyword-spelling -->. The
+// check names are those returned by CheckNames and "all" turns off every
+// check.
+const disableDirective = "chktiles:disable"
+
+// parseDirectives returns the set of check names disabled by chktiles:disable
+// comments anywhere in the document. Unknown check names are reported as
+// warnings.
+func parseDirectives(c *collector, path string, node *xmlquery.Node) map[string]bool {
+	disabled := make(map[string]bool)
+
+	for _, n := range xmlquery.Find(node, "//comment()") {
+		text := strings.TrimSpace(n.Data)
+		if !strings.HasPrefix(text, disableDirective) {
+			continue
+		}
+
+		for _, name := range strings.Split(strings.TrimPrefix(text, disableDirective), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := findCheck(name); !ok && name != "all" {
+				c.add(path, "parseDirectives", SeverityWarning, "Unknown check %q in %s comment", name, disableDirective)
+				continue
+			}
+			disabled[name] = true
+		}
+	}
+
+	return disabled
+}
+
+// checkFile runs the active checks on a single SVG file, except for those
+// disabled by a chktiles:disable comment in the file. A file that can't be
+// opened is reported as an "open" error so that the other files are still
+// checked.
+func checkFile(c *collector, path string) error {
+	if c.opts.Verbose {
+		fmt.Fprintf(os.Stderr, "checkFile%q\n", path)
+	}
+
+	file, err := openSvg(path)
+	if err != nil {
+		if c.opts.OnFile != nil {
+			c.opts.OnFile(path)
+		}
+		c.add(path, "open", SeverityError, "Unable to open file, %v", err)
+		return nil
+	}
+	defer file.Close()
+
+	return checkDocument(c, path, file)
+}
+
+// checkDocument parses the SVG document read from r and runs the active
+// checks on it, reporting the results against path. A document that can't be
+// parsed is reported as a "parse" error rather than failing the run.
+func checkDocument(c *collector, path string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(headSize)
+	c.head = append([]byte(nil), head...)
+
+	if c.opts.OnFile != nil {
+		c.opts.OnFile(path)
+	}
+
+	rootNode, err := parseSvg(br)
+	if err != nil {
+		c.add(path, "parse", SeverityError, "%s", describeParseError(err))
+		return nil
+	}
+
+	if c.opts.Verbose {
+		printSvg(rootNode)
+	}
+
+	if c.opts.OnTile != nil {
+		c.opts.OnTile(c.describeTile(path, rootNode))
+	}
+
+	disabled := parseDirectives(c, path, rootNode)
+	if disabled["all"] {
+		return nil
+	}
+
+	for _, chk := range c.checks {
+		if disabled[chk.name] {
+			continue
+		}
+		start := time.Now()
+		chk.fn(c, path, rootNode)
+		if c.opts.OnCheck != nil {
+			c.opts.OnCheck(chk.name, time.Since(start))
+		}
+	}
+
+	return nil
+}
+
+// checkFiles runs checkFile on each of paths using a pool of Jobs workers
+// and merges their results into c. The results are sorted by path so that
+// the output doesn't depend on the order in which the workers finish. No new
+// files are started once one of them has failed.
+func checkFiles(c *collector, paths []string) error {
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	done := 0
+	stop := false
+
+	jobs := make(chan string)
+	for i := 0; i < c.opts.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				fc := &collector{checker: c.checker}
+				err := checkFile(fc, path)
+
+				mu.Lock()
+				c.results = append(c.results, fc.results...)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if c.opts.FailFast && hasError(fc.results) {
+					stop = true
+				}
+				done++
+				if c.opts.Progress != nil {
+					c.opts.Progress(done, len(paths))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		mu.Lock()
+		failed := firstErr != nil || stop
+		mu.Unlock()
+		if failed {
+			break
+		}
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(c.results, func(i, j int) bool {
+		return c.results[i].Path < c.results[j].Path
+	})
+
+	return firstErr
+}
+
+// hasError reports whether any of results is an error.
+func hasError(results []Result) bool {
+	for _, r := range results {
+		if r.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFile runs the checks selected by opts on the SVG file at path. The
+// duplicates check is skipped since there is no duplicate directory to
+// compare against, use CheckTree for that.
+//
+// If opts are invalid or the spelling dictionaries can't be loaded the
+// results are nil. Otherwise they are never nil, even when the file can't be
+// read.
+func CheckFile(path string, opts Options) ([]Result, error) {
+	k, err := newChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.open(); err != nil {
+		return nil, err
+	}
+	defer k.close()
+
+	c := &collector{checker: k, results: []Result{}}
+	err = checkFiles(c, []string{path})
+	return c.results, err
+}
+
+// CheckReader runs the checks selected by opts on the SVG document read from
+// r, which may be gzip compressed. name is used as the path in the results.
+// As with CheckFile the duplicates check is skipped, and so is the
+// comparison of dc:identifier with the file name unless name ends in .svg or
+// .svgz.
+func CheckReader(r io.Reader, name string, opts Options) ([]Result, error) {
+	k, err := newChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.open(); err != nil {
+		return nil, err
+	}
+	defer k.close()
+
+	c := &collector{checker: k, results: []Result{}}
+
+	svg, err := newSvgReader(r, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkFile\tERROR\tunable to read %q, %v\n", name, err)
+		return c.results, err
+	}
+	defer svg.Close()
+
+	if c.opts.Verbose {
+		fmt.Fprintf(os.Stderr, "checkFile%q\n", name)
+	}
+
+	err = checkDocument(c, name, svg)
+	if c.opts.Progress != nil {
+		c.opts.Progress(1, 1)
+	}
+	return c.results, err
+}
+
+// findFiles returns the SVG files to check in dir, which is either a single
+// SVG file or a directory tree, leaving out those not matching the Include
+// patterns and those excluded by the Exclude patterns, the .chktilesignore
+// file or MaxDepth. If the walk fails the
+// files found so far are returned with the error, for any other error the
+// files are nil.
+func (k *checker) findFiles(dir string) ([]string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkTiles\tERROR\tunable to access path %q, %v\n", dir, err)
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if !isSvgPath(dir) {
+			err = fmt.Errorf("%q is not an SVG file", dir)
+			fmt.Fprintf(os.Stderr, "checkTiles\tERROR\t%v\n", err)
+			return nil, err
+		}
+		return []string{dir}, nil
+	}
+
+	ignorePatterns, err := loadIgnoreFile(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkTiles\tERROR\tunable to read %q, %v\n", ignoreFileName, err)
+		return nil, err
+	}
+	patterns := append(append([]globPattern{}, k.exclude...), ignorePatterns...)
+
+	paths := []string{}
+	err = walkTree(dir, k.opts.FollowSymlinks, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "checkTiles\tERROR\tunable to access path %q, %v\n", path, err)
+			// Only an unreadable dir is fatal, anything below it is
+			// skipped.
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+
+		if isExcluded(patterns, dir, path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() && isTooDeep(dir, path, k.opts.MaxDepth) {
+			return filepath.SkipDir
+		}
+
+		if !isSvgPath(path) || !isIncluded(k.include, dir, path) {
+			return nil
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkTiles\tERROR\tunable to walk directory %q, %v\n", dir, err)
+	}
+
+	return paths, err
+}
+
+// findAllFiles returns the files found by findFiles in each of dirs. A file
+// found more than once, directly or through a symbolic link, is only
+// returned the first time. An error in one of dirs doesn't stop the others
+// from being searched, the first error is returned.
+func (k *checker) findAllFiles(dirs []string) ([]string, error) {
+	var paths []string
+	var firstErr error
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		found, err := k.findFiles(dir)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		for _, path := range found {
+			if resolved := resolvePath(path); !seen[resolved] {
+				seen[resolved] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths, firstErr
+}
+
+// ListFiles returns the SVG files CheckTrees would check in dirs with opts,
+// without checking them. Any files found despite an error are returned with
+// the error.
+func ListFiles(dirs []string, opts Options) ([]string, error) {
+	k, err := newChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.findAllFiles(dirs)
+}
+
+// CheckTree runs the checks selected by opts on dir, which is either a single
+// SVG file or a directory tree to search for SVG files, and compares them
+// against the SVG files found in dupDir. The duplicates check is skipped if
+// dupDir is "". Paths matching opts.Exclude or a
+// pattern in a .chktilesignore file at the root of dir are skipped.
+//
+// The results are nil when opts are invalid or the spelling dictionaries
+// can't be loaded. Otherwise the results found so far are returned even when
+// an error stops the walk.
+func CheckTree(dir string, dupDir string, opts Options) ([]Result, error) {
+	return CheckTrees([]string{dir}, dupDir, opts)
+}
+
+// CheckTrees is like CheckTree but checks each of dirs in turn, together
+// with their results. A file found in more than one of them, directly or
+// through a symbolic link, is only checked once. An error in one of dirs
+// doesn't stop the others from being checked, the first error is returned.
+func CheckTrees(dirs []string, dupDir string, opts Options) ([]Result, error) {
+	k, err := newChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.open(); err != nil {
+		return nil, err
+	}
+	defer k.close()
+
+	c := &collector{checker: k, results: []Result{}}
+
+	paths, err := k.findAllFiles(dirs)
+	if len(paths) == 0 && err != nil {
+		return c.results, err
+	}
+
+	var dupErr error
+	if k.isActive("duplicates") && dupDir != "" {
+		k.dups, dupErr = k.buildDupIndex(dupDir)
+	}
+
+	if checkErr := checkFiles(c, paths); err == nil {
+		err = checkErr
+	}
+
+	if err == nil {
+		err = dupErr
+	}
+
+	if k.dups != nil && k.dups.cache != nil {
+		if cacheErr := k.dups.cache.save(); cacheErr != nil {
+			fmt.Fprintf(os.Stderr, "checkTiles\tERROR\tunable to write the hash cache %q, %v\n", opts.Cache, cacheErr)
+			if err == nil {
+				err = cacheErr
+			}
+		}
+	}
+
+	return c.results, err
+}
@@ -0,0 +1,186 @@
+package chklib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// tileSvg is a small tile with a title, keywords and no description, so
+// that the title check passes and the description check always has a
+// result to report.
+const tileSvg = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg"
+   xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+   viewBox="0 0 120 120" width="120" height="120">
+  <title>Square</title>
+  <metadata>
+    <rdf:RDF><rdf:Bag><rdf:li>square</rdf:li></rdf:Bag></rdf:RDF>
+  </metadata>
+  <rect x="10" y="10" width="100" height="100" />
+</svg>
+`
+
+// writeFile creates the file name in dir with content and returns its path.
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testOptions returns the default options with only the named checks and
+// without the spelling dictionaries.
+func testOptions(checks ...string) Options {
+	opts := DefaultOptions()
+	opts.Checks = checks
+	opts.NoSpelling = true
+	return opts
+}
+
+// resultsFor returns the results reported against path.
+func resultsFor(results []Result, path string) []Result {
+	var found []Result
+	for _, r := range results {
+		if r.Path == path {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func TestSeverityOverride(t *testing.T) {
+	t.Run("duplicates", func(t *testing.T) {
+		checkDir := t.TempDir()
+		dupDir := t.TempDir()
+		path := writeFile(t, checkDir, "a.svg", tileSvg)
+		writeFile(t, dupDir, "b.svg", tileSvg)
+
+		opts := testOptions("duplicates")
+		opts.Severity = map[string]string{"duplicates": "error"}
+		results, err := CheckTree(checkDir, dupDir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := resultsFor(results, path)
+		if len(found) != 1 {
+			t.Fatalf("got %d results for %s, want 1: %v", len(found), path, results)
+		}
+		if found[0].Severity != SeverityError {
+			t.Errorf("duplicate reported as %s, want %s", found[0].Severity, SeverityError)
+		}
+	})
+
+	t.Run("keyword-spelling", func(t *testing.T) {
+		opts := testOptions()
+		opts.Severity = map[string]string{"keyword-spelling": "warning"}
+		k, err := newChecker(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &collector{checker: k}
+		c.addMisspelled("a.svg", "checkKeywordSpelling", "Keywords", []string{"mispelled"})
+		if len(c.results) != 1 || c.results[0].Severity != SeverityWarning {
+			t.Errorf("got %v, want a single %s", c.results, SeverityWarning)
+		}
+	})
+
+	t.Run("unknown level", func(t *testing.T) {
+		opts := testOptions()
+		opts.Severity = map[string]string{"units": "loud"}
+		if err := opts.Validate(); err == nil {
+			t.Error("an unknown severity was accepted")
+		}
+	})
+}
+
+// TestCheckTreeBadFiles checks that a file that can't be opened or parsed is
+// reported as an error without stopping the other files being checked.
+func TestCheckTreeBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	good := []string{
+		writeFile(t, dir, "a.svg", tileSvg),
+		writeFile(t, dir, "d.svg", tileSvg),
+	}
+	corrupt := writeFile(t, dir, "b.svgz", "not gzip data")
+	malformed := writeFile(t, dir, "c.svg", "<svg><title>Broken</svg>")
+
+	results, err := CheckTree(dir, "", testOptions("title", "description"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, check := range map[string]string{corrupt: "open", malformed: "parse"} {
+		found := resultsFor(results, path)
+		if len(found) != 1 || found[0].Check != check || found[0].Severity != SeverityError {
+			t.Errorf("results for %s = %v, want a single %s %s", path, found, check, SeverityError)
+		}
+	}
+
+	for _, path := range good {
+		found := resultsFor(results, path)
+		if len(found) != 1 || found[0].Check != "checkDescription" {
+			t.Errorf("results for %s = %v, want a single checkDescription result", path, found)
+		}
+	}
+}
+
+// TestNoSvgRoot checks that a document without an svg element is reported
+// as an error by the checks that need it, and doesn't crash the others.
+func TestNoSvgRoot(t *testing.T) {
+	path := "../test-data/no-svg-root.svg"
+	results, err := CheckFile(path, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := make(map[string]bool)
+	for _, r := range results {
+		if r.Message == "SVG element missing" && r.Severity == SeverityError {
+			missing[r.Check] = true
+		}
+	}
+	for _, check := range []string{"checkSize", "checkUnits"} {
+		if !missing[check] {
+			t.Errorf("%s didn't report the missing svg element: %v", check, results)
+		}
+	}
+}
+
+// TestCompressed checks a real gzipped tile, both by name and from a reader
+// without a .svgz name, where only the gzip magic number identifies it. The
+// tile has a title and identifier but no description, so the description
+// check is the only one with a result once it has been decompressed and
+// parsed.
+func TestCompressed(t *testing.T) {
+	path := "../test-data/compressed.svgz"
+	opts := testOptions("title", "description", "identifier")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Fatalf("%s is not gzip compressed", path)
+	}
+
+	fromFile, err := CheckFile(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromReader, err := CheckReader(bytes.NewReader(data), "-", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for source, results := range map[string][]Result{"CheckFile": fromFile, "CheckReader": fromReader} {
+		if len(results) != 1 || results[0].Check != "checkDescription" {
+			t.Errorf("%s: got %v, want a single checkDescription result", source, results)
+		}
+	}
+}
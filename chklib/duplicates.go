@@ -0,0 +1,356 @@
+package chklib
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// hashAlgorithms maps the names accepted by the Hash option to their
+// constructors.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+}
+
+func makeHash(path string, algorithm string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "makeHash\tERROR\tunable to open %q, %v\n", path, err)
+		return ""
+	}
+	defer f.Close()
+
+	h := hashAlgorithms[algorithm]()
+	if _, err := io.Copy(h, f); err != nil {
+		fmt.Fprintf(os.Stderr, "makeHash\tERROR\tunable to create hash of %q, %v\n", path, err)
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// getFileSize returns the size in bytes of the file at path.
+func getFileSize(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get size of %q, %v", path, err)
+	}
+
+	return fi.Size(), nil
+}
+
+// dupIndex records the SVG files found in the duplicate directory by name
+// and size so that each checked file can be compared against them without
+// walking the directory again. Hashes are only computed for files whose size
+// matches a checked file, and are remembered once computed. Sizes and hashes
+// are always of the raw file, so a .svgz file is only a duplicate of another
+// file with the same compressed bytes. With StructuralDup the structural
+// hash of every file is also computed, on first use.
+type dupIndex struct {
+	root      string
+	byName    map[string][]string
+	bySize    map[int64][]string
+	paths     []string
+	algorithm string
+
+	// cache, if not nil, holds the hashes from previous runs.
+	cache *hashCache
+
+	// mu guards hashes and cache. It is only held to read and update them,
+	// never while a file is read, so that the workers can hash different
+	// files at the same time.
+	mu     sync.Mutex
+	hashes map[string]*hashEntry
+
+	structureOnce sync.Once
+	byStructure   map[string][]string
+}
+
+// hashEntry is the hash of one file, computed once however many workers
+// ask for it.
+type hashEntry struct {
+	once sync.Once
+	hash string
+}
+
+// hash returns the hash of path, computing it on first use unless it is in
+// the cache.
+func (index *dupIndex) hash(path string) string {
+	index.mu.Lock()
+	entry, ok := index.hashes[path]
+	if !ok {
+		entry = &hashEntry{}
+		index.hashes[path] = entry
+	}
+	index.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.hash = index.computeHash(path)
+	})
+	return entry.hash
+}
+
+// computeHash looks path up in the cache, or hashes the file and stores the
+// result in the cache.
+func (index *dupIndex) computeHash(path string) string {
+	if index.cache == nil {
+		return makeHash(path, index.algorithm)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return makeHash(path, index.algorithm)
+	}
+
+	index.mu.Lock()
+	h, ok := index.cache.lookup(path, info)
+	index.mu.Unlock()
+	if ok {
+		return h
+	}
+
+	h = makeHash(path, index.algorithm)
+	if h != "" {
+		index.mu.Lock()
+		index.cache.store(path, info, h)
+		index.mu.Unlock()
+	}
+	return h
+}
+
+// sameStructure returns the files in the duplicate directory with the given
+// structural hash. The structural hashes of all the files are computed the
+// first time it is called.
+func (k *checker) sameStructure(hash string) []string {
+	index := k.dups
+	index.structureOnce.Do(func() {
+		index.byStructure = make(map[string][]string)
+		for _, path := range index.paths {
+			h := k.fileStructuralHash(path)
+			if h != "" {
+				index.byStructure[h] = append(index.byStructure[h], path)
+			}
+		}
+	})
+
+	return index.byStructure[hash]
+}
+
+// fileStructuralHash parses the SVG file at path and returns its structural
+// hash, or "" if it can't be parsed.
+func (k *checker) fileStructuralHash(path string) string {
+	file, err := openSvg(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fileStructuralHash\tERROR\tunable to open %q, %v\n", path, err)
+		return ""
+	}
+	defer file.Close()
+
+	node, err := parseSvg(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fileStructuralHash\tERROR\tunable to parse %q, %v\n", path, err)
+		return ""
+	}
+
+	return k.structuralHash(node)
+}
+
+// buildDupIndex walks dupDir once and indexes every SVG file in it, except
+// for those matching the Exclude patterns or below MaxDepth. Files are hashed with the Hash
+// algorithm, using the hashes in the Cache file when it is set.
+func (k *checker) buildDupIndex(dupDir string) (*dupIndex, error) {
+	index := &dupIndex{
+		root:      dupDir,
+		byName:    make(map[string][]string),
+		bySize:    make(map[int64][]string),
+		algorithm: k.opts.Hash,
+		hashes:    make(map[string]*hashEntry),
+	}
+
+	if k.opts.Cache != "" {
+		cache, err := loadHashCache(k.opts.Cache, k.opts.Hash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "buildDupIndex\tERROR\tunable to read the hash cache %q, %v\n", k.opts.Cache, err)
+			return index, err
+		}
+		index.cache = cache
+	}
+
+	err := walkTree(dupDir, k.opts.FollowSymlinks, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "buildDupIndex\tERROR\tunable to access %q, %v\n", path, err)
+			return err
+		}
+
+		if isExcluded(k.exclude, dupDir, path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() && isTooDeep(dupDir, path, k.opts.MaxDepth) {
+			return filepath.SkipDir
+		}
+
+		if !isSvgPath(path) {
+			return nil
+		}
+
+		name := filepath.Base(path)
+		index.byName[name] = append(index.byName[name], path)
+
+		size := info.Size()
+		index.bySize[size] = append(index.bySize[size], path)
+
+		index.paths = append(index.paths, path)
+
+		return nil
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "buildDupIndex\tERROR\tunable to walk directory %q, %v\n", dupDir, err)
+	}
+
+	return index, err
+}
+
+// resolvePath returns the absolute, symlink resolved form of path, or path
+// itself if it can't be resolved.
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+
+	return resolved
+}
+
+// checkDuplicates compares checkPath against the duplicate directory index.
+// Each matching file is reported once, by its path relative to the
+// duplicate directory, along with the ways in which it matched. A file with
+// the same content is only reported as a content match, while name and size
+// matches are reported for files whose content differs. With StructuralDup
+// files that look the same but whose content differs are reported as having
+// the same structure. With Verbose set every kind of match is listed.
+func checkDuplicates(c *collector, checkPath string, node *xmlquery.Node) {
+	if c.dups == nil {
+		return
+	}
+
+	// The check and duplicate directories may overlap, so make sure a file
+	// is never reported as a duplicate of itself.
+	self := resolvePath(checkPath)
+
+	sameName := make(map[string]bool)
+	for _, path := range c.dups.byName[filepath.Base(checkPath)] {
+		if resolvePath(path) != self {
+			sameName[path] = true
+		}
+	}
+
+	sameSize := make(map[string]bool)
+	if size, err := getFileSize(checkPath); err != nil {
+		fmt.Fprintf(os.Stderr, "checkDuplicates\tERROR\t%v\n", err)
+	} else {
+		for _, path := range c.dups.bySize[size] {
+			if resolvePath(path) != self {
+				sameSize[path] = true
+			}
+		}
+	}
+
+	// Files of different sizes can't have the same content, so only hash
+	// when there is something of the same size to compare against.
+	sameHash := make(map[string]bool)
+	if len(sameSize) > 0 {
+		if hash := c.dups.hash(checkPath); hash != "" {
+			for path := range sameSize {
+				if c.dups.hash(path) == hash {
+					sameHash[path] = true
+				}
+			}
+		}
+	}
+
+	sameStructure := make(map[string]bool)
+	if c.opts.StructuralDup {
+		for _, path := range c.sameStructure(c.structuralHash(node)) {
+			if resolvePath(path) != self {
+				sameStructure[path] = true
+			}
+		}
+	}
+
+	var candidates []string
+	for path := range sameName {
+		candidates = append(candidates, path)
+	}
+	for path := range sameSize {
+		if !sameName[path] {
+			candidates = append(candidates, path)
+		}
+	}
+	for path := range sameStructure {
+		if !sameName[path] && !sameSize[path] {
+			candidates = append(candidates, path)
+		}
+	}
+	sort.Strings(candidates)
+
+	// All the ways a file matched are reported together. Unless running
+	// verbosely a content match makes the others redundant, as does a
+	// structure match.
+	for _, path := range candidates {
+		var matches []string
+		switch {
+		case sameHash[path] && !c.opts.Verbose:
+			matches = []string{"content"}
+		case sameStructure[path] && !c.opts.Verbose:
+			matches = []string{"structure"}
+		default:
+			if sameName[path] {
+				matches = append(matches, "name")
+			}
+			if sameSize[path] {
+				matches = append(matches, "size")
+			}
+			if sameHash[path] {
+				matches = append(matches, "content")
+			}
+			if sameStructure[path] {
+				matches = append(matches, "structure")
+			}
+		}
+
+		rel, err := filepath.Rel(c.dups.root, path)
+		if err != nil {
+			rel = path
+		}
+
+		c.addResult(Result{
+			Path:      checkPath,
+			Check:     "checkDuplicates",
+			Severity:  SeverityWarning,
+			Message:   fmt.Sprintf("duplicate %s %q", strings.Join(matches, " and "), rel),
+			Duplicate: rel,
+			Match:     strings.Join(matches, ","),
+		})
+	}
+}
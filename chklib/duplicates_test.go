@@ -0,0 +1,122 @@
+package chklib
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetFileSize(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "a.svg", tileSvg)
+
+	size, err := getFileSize(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(tileSvg)) {
+		t.Errorf("getFileSize(%q) = %d, want %d", path, size, len(tileSvg))
+	}
+
+	missing := filepath.Join(dir, "missing.svg")
+	size, err = getFileSize(missing)
+	if err == nil {
+		t.Fatalf("getFileSize(%q) = %d, want an error", missing, size)
+	}
+	if want := `unable to get size of "` + missing + `"`; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("getFileSize(%q) error = %q, want it to start with %q", missing, err, want)
+	}
+}
+
+func TestMakeHash(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.svg", tileSvg)
+	b := writeFile(t, dir, "b.svg", tileSvg)
+	c := writeFile(t, dir, "c.svg", strings.Replace(tileSvg, "Square", "Box", 1))
+
+	for _, algorithm := range []string{"md5", "sha256"} {
+		hashA := makeHash(a, algorithm)
+		if hashA == "" {
+			t.Fatalf("%s: no hash for %s", algorithm, a)
+		}
+		if hashB := makeHash(b, algorithm); hashB != hashA {
+			t.Errorf("%s: identical files hash to %s and %s", algorithm, hashA, hashB)
+		}
+		if hashC := makeHash(c, algorithm); hashC == hashA {
+			t.Errorf("%s: different files both hash to %s", algorithm, hashA)
+		}
+	}
+}
+
+// TestDuplicatesSameDir checks a directory against itself. Each file must
+// not match itself, but the copy of a.svg is still a duplicate of it.
+func TestDuplicatesSameDir(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.svg", tileSvg)
+	b := writeFile(t, dir, "b.svg", tileSvg)
+	c := writeFile(t, dir, "c.svg", strings.Replace(tileSvg, "Square", "Box", 1))
+
+	results, err := CheckTree(dir, dir, testOptions("duplicates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range results {
+		if filepath.Base(r.Path) == r.Duplicate {
+			t.Errorf("%s reported as a duplicate of itself: %s", r.Path, r.Message)
+		}
+	}
+
+	want := map[string]string{a: "b.svg", b: "a.svg"}
+	for path, dup := range want {
+		found := resultsFor(results, path)
+		if len(found) != 1 || found[0].Duplicate != dup || found[0].Match != "content" {
+			t.Errorf("results for %s = %v, want a content duplicate of %s", path, found, dup)
+		}
+	}
+	if found := resultsFor(results, c); len(found) != 0 {
+		t.Errorf("results for %s = %v, want none", c, found)
+	}
+}
+
+// TestDupIndexHashConcurrent hashes the same files from several goroutines,
+// as the workers do, and checks that they all get the same hashes. Run it
+// with -race.
+func TestDupIndexHashConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeFile(t, dir, "a.svg", tileSvg),
+		writeFile(t, dir, "b.svg", strings.Replace(tileSvg, "Square", "Box", 1)),
+	}
+
+	cache, err := loadHashCache(filepath.Join(dir, "cache.json"), "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := &dupIndex{algorithm: "sha256", cache: cache, hashes: make(map[string]*hashEntry)}
+
+	var wg sync.WaitGroup
+	got := make([][]string, 8)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, path := range paths {
+				got[i] = append(got[i], index.hash(path))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, hashes := range got {
+		for j, path := range paths {
+			if want := makeHash(path, "sha256"); hashes[j] != want {
+				t.Errorf("worker %d: hash of %s = %q, want %q", i, path, hashes[j], want)
+			}
+		}
+	}
+	if len(cache.Entries) != len(paths) {
+		t.Errorf("cache has %d entries, want %d", len(cache.Entries), len(paths))
+	}
+}
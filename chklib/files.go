@@ -0,0 +1,336 @@
+package chklib
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// globPattern is a compiled glob pattern. Patterns containing a / are
+// matched against the whole relative path, others only against the base name.
+type globPattern struct {
+	re       *regexp.Regexp
+	fullPath bool
+}
+
+// compileGlob converts a glob pattern to a regular expression. * and ? match
+// within a single path element, ** matches across elements and "**/" also
+// matches no directory at all. Character classes are passed through.
+func compileGlob(pattern string) (globPattern, error) {
+	pattern = filepath.ToSlash(pattern)
+
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				re.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return globPattern{}, fmt.Errorf("unterminated [ in pattern %q", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return globPattern{}, fmt.Errorf("invalid pattern %q, %v", pattern, err)
+	}
+
+	return globPattern{compiled, strings.Contains(pattern, "/")}, nil
+}
+
+func (g globPattern) match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if !g.fullPath {
+		rel = path.Base(rel)
+	}
+	return g.re.MatchString(rel)
+}
+
+// ignoreFileName is the name of the file listing patterns to exclude that is
+// read from the root of the check directory.
+const ignoreFileName = ".chktilesignore"
+
+// loadIgnoreFile reads the glob patterns in an ignore file, one per line.
+// Blank lines and lines starting with # are skipped. A missing file is not
+// an error.
+func loadIgnoreFile(path string) ([]globPattern, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []globPattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		g, err := compileGlob(line)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, g)
+	}
+
+	return patterns, scanner.Err()
+}
+
+// isExcluded reports whether path, found while walking root, matches any of
+// patterns.
+func isExcluded(patterns []globPattern, root string, path string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+
+	for _, g := range patterns {
+		if g.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncluded reports whether the file path, found while walking root,
+// matches any of patterns, or whether there are no patterns at all.
+func isIncluded(patterns []globPattern, root string, path string) bool {
+	return len(patterns) == 0 || isExcluded(patterns, root, path)
+}
+
+// walkTree walks the tree rooted at root like filepath.Walk. If follow is
+// true symbolic links to directories are walked as well, remembering the
+// directories already visited so that a link back up the tree doesn't walk
+// forever.
+func walkTree(root string, follow bool, fn filepath.WalkFunc) error {
+	if !follow {
+		return filepath.Walk(root, fn)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollow(root, info, make(map[string]bool), fn)
+	}
+
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkFollow walks path, whose info has been read with os.Stat so that links
+// are followed, for walkTree. visited holds the resolved paths of the
+// directories walked so far.
+func walkFollow(path string, info os.FileInfo, visited map[string]bool, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if visited[resolved] {
+			return nil
+		}
+		visited[resolved] = true
+	}
+
+	if err := fn(path, info, nil); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return fn(path, info, err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := filepath.Join(path, name)
+
+		// A broken link is passed on as the link itself.
+		childInfo, err := os.Stat(child)
+		if err != nil {
+			childInfo, err = os.Lstat(child)
+		}
+		if err != nil {
+			if err := fn(child, childInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+
+		if err := walkFollow(child, childInfo, visited, fn); err != nil {
+			if err != filepath.SkipDir {
+				return err
+			}
+			if !childInfo.IsDir() {
+				// As with filepath.Walk, SkipDir on a file skips the rest of
+				// the directory.
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// isTooDeep reports whether the files in dir, found while walking root, are
+// more than maxDepth directories below root. A maxDepth of -1 means there is
+// no limit.
+func isTooDeep(root string, dir string, maxDepth int) bool {
+	if maxDepth < 0 {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+
+	depth := len(strings.Split(filepath.ToSlash(rel), "/"))
+	return depth > maxDepth
+}
+
+// isSvgPath reports whether path names an SVG file, either plain or gzip
+// compressed.
+func isSvgPath(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".svg" || ext == ".svgz"
+}
+
+func trimSvgExt(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".svgz"), ".svg")
+}
+
+// svgFile wraps an open SVG file, transparently decompressing it when it is
+// gzip compressed. file is nil when the document isn't read from a file.
+type svgFile struct {
+	io.Reader
+	file *os.File
+	gz   *gzip.Reader
+}
+
+func (f *svgFile) Close() error {
+	if f.gz != nil {
+		f.gz.Close()
+	}
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// openSvg opens the SVG file at path for reading. Files with a .svgz
+// extension or starting with the gzip magic number are decompressed.
+func openSvg(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	svg, err := newSvgReader(file, filepath.Ext(path) == ".svgz")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	svg.file = file
+
+	return svg, nil
+}
+
+// newSvgReader returns a reader for the SVG document in r, which is
+// decompressed if compressed is true or it starts with the gzip magic
+// number.
+func newSvgReader(r io.Reader, compressed bool) (*svgFile, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if !compressed && !(len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b) {
+		return &svgFile{Reader: br}, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	return &svgFile{Reader: gz, gz: gz}, nil
+}
+
+func printSvg(node *xmlquery.Node) {
+	var n *xmlquery.Node
+	n = xmlquery.FindOne(node, "//svg")
+	if n == nil {
+		fmt.Fprintf(os.Stderr, "  ** No SVG element\n")
+		return
+	}
+	w := n.SelectAttr("width")
+	h := n.SelectAttr("height")
+	v := n.SelectAttr("viewBox")
+	fmt.Fprintf(os.Stderr, "  ** Width: %s, Height: %s, Viewbox: %s\n", w, h, v)
+}
+
+func parseSvg(reader io.Reader) (*xmlquery.Node, error) {
+	xmlDoc, err := xmlquery.Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return xmlDoc, nil
+}
+
+// describeParseError returns err from parseSvg as a message, starting with
+// the line it was found on when the parser reports it.
+func describeParseError(err error) string {
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("Unable to parse SVG, line %d: %s", syntaxErr.Line, syntaxErr.Msg)
+	}
+	return fmt.Sprintf("Unable to parse SVG, %v", err)
+}
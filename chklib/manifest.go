@@ -0,0 +1,56 @@
+package chklib
+
+import (
+	"os"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// Tile describes a checked tile for a catalog of the tiles, see
+// Options.OnTile.
+type Tile struct {
+	Path       string   `json:"path"`
+	Identifier string   `json:"identifier"`
+	Title      string   `json:"title"`
+	Keywords   []string `json:"keywords"`
+
+	// Width and Height are as given on the root <svg>, with their units,
+	// or taken from the viewBox when they are missing.
+	Width  string `json:"width"`
+	Height string `json:"height"`
+
+	// Hash is the hash of the file made with the Hash algorithm, or "" for
+	// a document that wasn't read from a file.
+	Hash string `json:"hash"`
+}
+
+// describeTile returns the Tile for the document at path whose root is
+// node.
+func (k *checker) describeTile(path string, node *xmlquery.Node) Tile {
+	tile := Tile{Path: path, Keywords: []string{}}
+
+	if n := xmlquery.FindOne(node, "//dc:identifier"); n != nil {
+		tile.Identifier = strings.TrimSpace(n.InnerText())
+	}
+
+	if n := xmlquery.FindOne(node, "//svg/title"); n != nil {
+		tile.Title = strings.TrimSpace(n.InnerText())
+	}
+
+	for _, n := range xmlquery.Find(node, "//rdf:li") {
+		if keyword := strings.TrimSpace(n.InnerText()); keyword != "" {
+			tile.Keywords = append(tile.Keywords, keyword)
+		}
+	}
+
+	if n := xmlquery.FindOne(node, "//svg"); n != nil {
+		tile.Width, tile.Height = getLengths(n)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		tile.Hash = makeHash(path, k.opts.Hash)
+	}
+
+	return tile
+}
@@ -0,0 +1,322 @@
+package chklib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/trustmaster/go-aspell"
+)
+
+// spellingChecks are the names of the checks that need the spellers.
+var spellingChecks = map[string]bool{
+	"keyword-spelling":  true,
+	"text-spelling":     true,
+	"title-spelling":    true,
+	"metadata-spelling": true,
+}
+
+// newSpellers creates the spellers, one for each of the Lang dictionaries,
+// if any of the active checks need them. A dictionary that can't be loaded
+// is an error, unless SpellingOptional is set in which case a single warning
+// is printed and the spelling checks are disabled.
+func (k *checker) newSpellers() error {
+	needed := false
+	for _, chk := range k.checks {
+		if spellingChecks[chk.name] {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	for _, lang := range k.opts.Lang {
+		lang = strings.TrimSpace(lang)
+		s, err := aspell.NewSpeller(map[string]string{"lang": lang})
+		if err != nil {
+			k.deleteSpellers()
+			if !k.opts.SpellingOptional {
+				return fmt.Errorf("unable to load the %q dictionary, %v", lang, err)
+			}
+			fmt.Fprintf(os.Stderr, "newSpellers\tWARNING\tspelling checks disabled, %v\n", err)
+			return nil
+		}
+		k.spellers = append(k.spellers, s)
+	}
+
+	return nil
+}
+
+func (k *checker) deleteSpellers() {
+	for _, s := range k.spellers {
+		s.Delete()
+	}
+	k.spellers = nil
+}
+
+// loadAllowedWords reads the newline delimited list of words in path into
+// allowedWords. Blank lines are ignored.
+func (k *checker) loadAllowedWords(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word != "" {
+			k.allowedWords[strings.ToLower(word)] = true
+		}
+	}
+
+	return scanner.Err()
+}
+
+// spelledCorrectly reports whether word is in the allowed words list or is
+// accepted by any of the spellers.
+func (k *checker) spelledCorrectly(word string) bool {
+	if k.allowedWords[strings.ToLower(word)] {
+		return true
+	}
+
+	k.spellMu.Lock()
+	defer k.spellMu.Unlock()
+
+	for _, s := range k.spellers {
+		if s.Check(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSuggestions is the number of corrections offered for each misspelled
+// word.
+const maxSuggestions = 2
+
+// suggest returns up to maxSuggestions corrections for word, taken from the
+// first speller that has any.
+func (k *checker) suggest(word string) []string {
+	k.spellMu.Lock()
+	defer k.spellMu.Unlock()
+
+	for _, s := range k.spellers {
+		if suggestions := s.Suggest(word); len(suggestions) > 0 {
+			if len(suggestions) > maxSuggestions {
+				suggestions = suggestions[:maxSuggestions]
+			}
+			return suggestions
+		}
+	}
+	return nil
+}
+
+// describeMisspelled lists the misspelled words for a result, each with the
+// corrections aspell suggests for it, e.g. "recieve (did you mean:
+// receive?)".
+func (k *checker) describeMisspelled(words []string) string {
+	var described []string
+	for _, word := range words {
+		if suggestions := k.suggest(word); len(suggestions) > 0 {
+			word = fmt.Sprintf("%s (did you mean: %s?)", word, strings.Join(suggestions, " or "))
+		}
+		described = append(described, word)
+	}
+	return strings.Join(described, ", ")
+}
+
+// addMisspelled reports the misspelled words found in what, such as the
+// keywords or the text, by one of the spelling checks.
+func (c *collector) addMisspelled(path string, check string, what string, words []string) {
+	c.addResult(Result{
+		Path:     path,
+		Check:    check,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("%s misspelled: %s", what, c.describeMisspelled(words)),
+		Words:    words,
+	})
+}
+
+func checkKeywordSpelling(c *collector, path string, node *xmlquery.Node) {
+	if len(c.spellers) == 0 {
+		return
+	}
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//rdf:li")
+	if len(nodes) == 0 {
+		return
+	}
+
+	var keywords []string
+	for _, n := range nodes {
+		keywords = append(keywords, n.InnerText())
+	}
+
+	var misspelled []string
+	for _, keyword := range keywords {
+		misspelled = append(misspelled, c.misspelledWords(keyword)...)
+	}
+
+	if len(misspelled) > 0 {
+		c.addMisspelled(path, "checkKeywordSpelling", "Keywords", misspelled)
+	}
+}
+
+// checkTspanSpelling spell checks the visible text of the tile, both the
+// content of tspan elements and any text placed directly in a text element
+// outside of a tspan.
+func checkTspanSpelling(c *collector, path string, node *xmlquery.Node) {
+	if len(c.spellers) == 0 {
+		return
+	}
+
+	var tspans []string
+
+	var nodes []*xmlquery.Node
+	nodes = xmlquery.Find(node, "//tspan")
+	for _, n := range nodes {
+		tspans = append(tspans, n.InnerText())
+	}
+
+	// Only the text element's own text children are used, text inside a
+	// tspan has already been collected above.
+	nodes = xmlquery.Find(node, "//text")
+	for _, n := range nodes {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == xmlquery.TextNode {
+				if text := strings.TrimSpace(child.Data); text != "" {
+					tspans = append(tspans, text)
+				}
+			}
+		}
+	}
+
+	if len(tspans) == 0 {
+		return
+	}
+
+	var misspelled []string
+	for _, tspan := range tspans {
+		misspelled = append(misspelled, c.misspelledWords(tspan)...)
+	}
+
+	if len(misspelled) > 0 {
+		c.addMisspelled(path, "checkTspanSpelling", "Text", misspelled)
+	}
+}
+
+// isWordBreak reports whether r separates words. Apostrophes and hyphens
+// only separate words at their start or end, see tokenizeWords.
+func isWordBreak(r rune) bool {
+	switch r {
+	case '\'', '\u2019', '-':
+		return false
+	}
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// tokenizeWords splits text into the words to spell check. Words are
+// separated by whitespace and punctuation, such as the slashes around
+// phonemes, except that apostrophes and hyphens within a word are kept so
+// that "don't" and "well-known" are checked whole.
+func tokenizeWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, isWordBreak) {
+		word = strings.TrimFunc(word, func(r rune) bool { return r == '\'' || r == '\u2019' || r == '-' })
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// measurementRe matches a number, optionally followed by a unit or
+// preceded by a v as in a version number.
+var measurementRe = regexp.MustCompile(`^[vV]?[0-9]+(?:[.,][0-9]+)*([a-zA-Z%]*)$`)
+
+// isMeasurement reports whether word is a number, a version number such as
+// v2 or a length with one of the units the size checks understand, none of
+// which are in the dictionaries.
+func isMeasurement(word string) bool {
+	m := measurementRe.FindStringSubmatch(word)
+	if m == nil {
+		return false
+	}
+
+	unit := strings.ToLower(m[1])
+	if unit == "" {
+		return true
+	}
+	_, absolute := pxPerUnit[unit]
+	return absolute || relativeUnits[unit]
+}
+
+// misspelledWords returns the words in text that aren't spelled correctly.
+// Numbers and measurements are skipped.
+func (k *checker) misspelledWords(text string) []string {
+	var misspelled []string
+	for _, word := range tokenizeWords(text) {
+		if !isMeasurement(word) && !k.spelledCorrectly(word) {
+			misspelled = append(misspelled, word)
+		}
+	}
+	return misspelled
+}
+
+// checkTitleSpelling spell checks the title and desc elements, which are
+// what screen readers announce. The titles and descriptions are reported
+// separately.
+func checkTitleSpelling(c *collector, path string, node *xmlquery.Node) {
+	if len(c.spellers) == 0 {
+		return
+	}
+
+	for _, element := range []struct{ local, name string }{{"title", "Title"}, {"desc", "Description"}} {
+		var misspelled []string
+
+		var nodes []*xmlquery.Node
+		nodes = xmlquery.Find(node, nsQuery(svgNs, element.local))
+		for _, n := range nodes {
+			misspelled = append(misspelled, c.misspelledWords(n.InnerText())...)
+		}
+
+		if len(misspelled) > 0 {
+			c.addMisspelled(path, "checkTitleSpelling", element.name, misspelled)
+		}
+	}
+}
+
+// checkMetadataSpelling spell checks the dc:title and dc:description in the
+// metadata, which are shown in the tile browser. The dc:title elements that
+// name the creator or rights holder inside a cc:Agent are left alone, as
+// they are names rather than words. Missing or empty elements are skipped.
+func checkMetadataSpelling(c *collector, path string, node *xmlquery.Node) {
+	if len(c.spellers) == 0 {
+		return
+	}
+
+	for _, element := range []struct{ local, name string }{{"title", "Metadata title"}, {"description", "Metadata description"}} {
+		var misspelled []string
+
+		var nodes []*xmlquery.Node
+		nodes = xmlquery.Find(node, nsQuery(svgDcNs, element.local))
+		for _, n := range nodes {
+			if n.Parent != nil && n.Parent.NamespaceURI == svgCcNs && n.Parent.Data == "Agent" {
+				continue
+			}
+			misspelled = append(misspelled, c.misspelledWords(n.InnerText())...)
+		}
+
+		if len(misspelled) > 0 {
+			c.addMisspelled(path, "checkMetadataSpelling", element.name, misspelled)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package chklib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsMeasurement(t *testing.T) {
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"100", true},
+		{"3.5", true},
+		{"50%", true},
+		{"v2", true},
+		{"V1.2", true},
+		{"3px", true},
+		{"2em", true},
+		{"word", false},
+		{"10q", false},
+		{"3d", false},
+		{"v", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMeasurement(tt.word); got != tt.want {
+			t.Errorf("isMeasurement(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
+
+// TestMisspelledWords checks that measurements are filtered out before
+// spell checking. Without any spellers every other word is misspelled.
+func TestMisspelledWords(t *testing.T) {
+	k, err := newChecker(testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := k.misspelledWords("100 3.5 50% v2 12px word")
+	if want := []string{"word"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("misspelledWords = %q, want %q", got, want)
+	}
+}
+
+func TestTokenizeWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"don't", []string{"don't"}},
+		{"(test)", []string{"test"}},
+		{"color,", []string{"color"}},
+		{"red, green and blue.", []string{"red", "green", "and", "blue"}},
+		{"well-known", []string{"well-known"}},
+		{"'quoted' -dash-", []string{"quoted", "dash"}},
+		{"/b/ as in boy", []string{"b", "as", "in", "boy"}},
+		{" , ", nil},
+	}
+
+	for _, tt := range tests {
+		if got := tokenizeWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNewSpellers(t *testing.T) {
+	// spellingOptions makes a missing dictionary an error, which it isn't
+	// by default.
+	spellingOptions := func(lang string, checks ...string) Options {
+		opts := DefaultOptions()
+		opts.Checks = checks
+		opts.Lang = []string{lang}
+		opts.SpellingOptional = false
+		return opts
+	}
+
+	t.Run("loaded", func(t *testing.T) {
+		k, err := newChecker(spellingOptions("en_US", "keyword-spelling"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := k.newSpellers(); err != nil {
+			t.Skipf("the en_US dictionary isn't installed, %v", err)
+		}
+		defer k.deleteSpellers()
+
+		if len(k.spellers) != 1 {
+			t.Errorf("got %d spellers, want 1", len(k.spellers))
+		}
+	})
+
+	t.Run("unknown dictionary", func(t *testing.T) {
+		k, err := newChecker(spellingOptions("xx_NOPE", "keyword-spelling"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = k.newSpellers()
+		if err == nil || !strings.Contains(err.Error(), `unable to load the "xx_NOPE" dictionary`) {
+			t.Errorf("newSpellers error = %v, want the xx_NOPE dictionary to fail to load", err)
+		}
+		if len(k.spellers) != 0 {
+			t.Errorf("got %d spellers after an error, want 0", len(k.spellers))
+		}
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		opts := spellingOptions("xx_NOPE", "keyword-spelling")
+		opts.SpellingOptional = true
+		k, err := newChecker(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := k.newSpellers(); err != nil {
+			t.Errorf("newSpellers error = %v, want the spelling checks disabled", err)
+		}
+		if len(k.spellers) != 0 {
+			t.Errorf("got %d spellers, want 0", len(k.spellers))
+		}
+	})
+
+	t.Run("not needed", func(t *testing.T) {
+		k, err := newChecker(spellingOptions("xx_NOPE", "title"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := k.newSpellers(); err != nil {
+			t.Errorf("newSpellers error = %v, want no dictionary loaded", err)
+		}
+	})
+}
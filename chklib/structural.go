@@ -0,0 +1,100 @@
+package chklib
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// structuralSkip lists the elements that don't affect how a tile looks and
+// are left out of its structure.
+var structuralSkip = map[string]bool{
+	"metadata": true,
+	"title":    true,
+	"desc":     true,
+}
+
+// idRefRe matches a url(#id) reference to an element, in an attribute or a
+// style declaration.
+var idRefRe = regexp.MustCompile(`url\(\s*#([^)\s]+)\s*\)`)
+
+// structuralHash returns a hash of the structure of the document, which two
+// tiles that look the same share even if their bytes differ. Comments,
+// metadata, titles, descriptions and editor namespaces are ignored,
+// attributes are sorted, whitespace is collapsed and ids are renumbered in
+// document order with the references to them rewritten to match.
+func (k *checker) structuralHash(node *xmlquery.Node) string {
+	ids := make(map[string]string)
+	for _, n := range xmlquery.Find(node, "//*[@id]") {
+		id := n.SelectAttr("id")
+		if _, ok := ids[id]; !ok {
+			ids[id] = fmt.Sprintf("id%d", len(ids))
+		}
+	}
+
+	h := hashAlgorithms[k.opts.Hash]()
+	k.writeStructure(h, node, ids)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeStructure writes the canonical form of node and its children to w for
+// structuralHash.
+func (k *checker) writeStructure(w io.Writer, node *xmlquery.Node, ids map[string]string) {
+	switch node.Type {
+	case xmlquery.DocumentNode:
+		// Only the children are written.
+
+	case xmlquery.ElementNode:
+		if k.editorNs[node.NamespaceURI] || structuralSkip[node.Data] {
+			return
+		}
+
+		var attrs []string
+		for _, attr := range node.Attr {
+			if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") || k.editorNs[attr.NamespaceURI] {
+				continue
+			}
+
+			value := strings.Join(strings.Fields(attr.Value), " ")
+			if attr.Name.Local == "id" {
+				value = ids[value]
+			} else if strings.HasPrefix(value, "#") {
+				if id, ok := ids[value[1:]]; ok {
+					value = "#" + id
+				}
+			}
+			value = idRefRe.ReplaceAllStringFunc(value, func(ref string) string {
+				if id, ok := ids[idRefRe.FindStringSubmatch(ref)[1]]; ok {
+					return "url(#" + id + ")"
+				}
+				return ref
+			})
+
+			attrs = append(attrs, fmt.Sprintf("{%s}%s=%q", attr.NamespaceURI, attr.Name.Local, value))
+		}
+		sort.Strings(attrs)
+
+		fmt.Fprintf(w, "<{%s}%s %s>", node.NamespaceURI, node.Data, strings.Join(attrs, " "))
+		defer fmt.Fprintf(w, "</>")
+
+	case xmlquery.TextNode, xmlquery.CharDataNode:
+		if text := strings.Join(strings.Fields(node.Data), " "); text != "" {
+			fmt.Fprintf(w, "%q", text)
+		}
+		return
+
+	default:
+		// Comments, declarations and processing instructions don't change
+		// how the tile looks.
+		return
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		k.writeStructure(w, child, ids)
+	}
+}
@@ -1,350 +1,1032 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
-	"os"
 	"io"
-	"strings"
-	"regexp"
-	"strconv"
+	"os"
 	"path/filepath"
-	"crypto/md5"
-	"encoding/hex"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dqdgit/chktiles/chklib"
 	"github.com/pborman/getopt/v2"
-	"github.com/trustmaster/go-aspell"
-  "github.com/antchfx/xmlquery"
 )
 
-const svgNs = "http://www.w3.org/2000/svg"
-const svgDcNs = "http://purl.org/dc/elements/1.1/"
-const svgCcNs = "http://creativecommons.org/ns#"
-const svgRdfNs = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
-
-const pxPerIn = 96
-const pxPerMm = (0.039370787 * pxPerIn)
-const pxPerPt = (0.0138888889 * pxPerIn)
-const pxPerPc = (0.1666666667 * pxPerIn)
-const pxPerFt = (pxPerIn * 12)
-const pxPerCm = (0.3937007874 * pxPerIn)
-const pxPerM = (0.0254 * pxPerIn)
-
-const minWidth = 80
-const minHeight = 80
+// version is the release of chktiles, set at build time with
+//
+//	go build -ldflags "-X main.version=1.2.0"
+var version = "dev"
 
 var helpFlag bool
+var versionFlag bool
 var verboseFlag bool
+var quietFlag bool
+var jsonFlag bool
+var csvFlag bool
+var sarifFlag bool
+var junitFlag string
+var outputFlag string
+var noColorFlag bool
+var progressFlag bool
+var warningsAsErrorsFlag bool
+var minWidth = 80
+var minHeight = 80
+var minKeywords = 0
+var onlyFlag []string
+var skipFlag []string
+var severityFlag []string
+var langFlag = []string{"en_US"}
+var allowWordsFlag string
+var jobsFlag = runtime.NumCPU()
+var hashFlag = "md5"
+var cacheFlag string
+var structuralDupFlag bool
+var aspectFlag = "any"
+var maxBytes = 0
+var maxImageBytes = 0
+var requireLicenseFlag string
+var fontsFlag []string
+var paletteFlag string
+var maxNodes = 10000
+var maxPrecision = 3
+var minStrokeFlag = 0.5
+var editorNsFlag = chklib.DefaultOptions().EditorNamespaces
+var excludeFlag []string
+var includeFlag []string
+var followSymlinksFlag bool
+var maxDepthFlag = -1
+var failFastFlag bool
+var listFlag bool
+var filesFromFlag string
+var filesFrom0Flag string
+var dupDirFlag string
+var dumpWordsFlag string
+var manifestFlag string
+var noSpellFlag bool
+var rootFlag string
+var configFlag string
+var baselineFlag string
+var writeBaselineFlag bool
 
-func toFloat(s string) float64 {
-	re := regexp.MustCompile(`[^0-9\.]`)
-	f, err := strconv.ParseFloat(re.ReplaceAllString(s, ""), 64)
-	if err != nil {
-		fmt.Printf("toFloat\tERROR\tunable to convert %q, %v\n", s, err)
-	}
-	return f
-}
+// useColor is set when the severities in the results should be colored,
+// which is only done on a terminal.
+var useColor bool
 
-func getUnitConversion(value string) float64 {
-	if strings.HasSuffix(value, "in") {
-		return pxPerIn
-	} else if strings.HasSuffix(value, "mm") {
-		return pxPerMm
-	} else if strings.HasSuffix(value, "pt") {
-		return pxPerPt
-	} else if strings.HasSuffix(value, "pc") {
-		return pxPerPc
-	} else if strings.HasSuffix(value, "ft") {
-		return pxPerFt
-	} else if strings.HasSuffix(value, "cm") {
-		return pxPerCm
-	} else if strings.HasSuffix(value, "m") {
-		return pxPerM
-	} 
-	
-	return 1.0
-}
+// The ANSI escape sequences used to color the severities.
+const colorRed = "\x1b[31m"
+const colorYellow = "\x1b[33m"
+const colorReset = "\x1b[0m"
 
 func init() {
 	getopt.Flag(&helpFlag, '?', "display help")
+	getopt.FlagLong(&versionFlag, "version", 'V', "display version information")
+	getopt.FlagLong(&configFlag, "config", 0, "read options from FILE", "FILE")
 	getopt.Flag(&verboseFlag, 'v', "output additional information")
+	getopt.FlagLong(&quietFlag, "quiet", 'q', "only output errors")
+	getopt.FlagLong(&jsonFlag, "json", 'j', "output results as JSON")
+	getopt.FlagLong(&csvFlag, "csv", 0, "output results as CSV")
+	getopt.FlagLong(&sarifFlag, "sarif", 0, "output results as SARIF")
+	getopt.FlagLong(&junitFlag, "junit", 0, "write a JUnit XML report to FILE, - for stdout", "FILE")
+	getopt.FlagLong(&outputFlag, "output", 'o', "write the results to FILE instead of stdout", "FILE")
+	getopt.FlagLong(&rootFlag, "root", 0, "report paths relative to DIR", "DIR")
+	getopt.FlagLong(&noColorFlag, "no-color", 0, "don't color the severities")
+	getopt.FlagLong(&progressFlag, "progress", 0, "show the number of files checked")
+	getopt.FlagLong(&warningsAsErrorsFlag, "warnings-as-errors", 'W', "treat warnings as errors")
+	getopt.FlagLong(&minWidth, "min-width", 0, "minimum tile width in px", "N")
+	getopt.FlagLong(&minHeight, "min-height", 0, "minimum tile height in px", "N")
+	getopt.FlagLong(&minKeywords, "min-keywords", 0, "minimum number of keywords in a tile", "N")
+	getopt.FlagLong(&onlyFlag, "only", 0, "comma separated list of checks to run", "CHECKS")
+	getopt.FlagLong(&skipFlag, "skip", 0, "comma separated list of checks to skip", "CHECKS")
+	getopt.FlagLong(&severityFlag, "severity", 0, "report the results of CHECK as LEVEL, error or warning, may be repeated", "CHECK=LEVEL")
+	getopt.FlagLong(&langFlag, "lang", 0, "comma separated list of spelling dictionaries", "LANGS")
+	getopt.FlagLong(&noSpellFlag, "no-spell", 0, "turn off the spelling checks")
+	getopt.FlagLong(&allowWordsFlag, "allow-words", 0, "file of words to accept during spell checks", "FILE")
+	getopt.FlagLong(&allowWordsFlag, "dictionary", 0, "same as --allow-words", "FILE")
+	getopt.FlagLong(&dumpWordsFlag, "dump-words", 0, "write the misspelled words found to FILE", "FILE")
+	getopt.FlagLong(&manifestFlag, "manifest", 0, "write a JSON catalog of the tiles checked to FILE", "FILE")
+	getopt.FlagLong(&jobsFlag, "jobs", 0, "number of files to check in parallel", "N")
+	getopt.FlagLong(&dupDirFlag, "dup-dir", 0, "directory tree to look for duplicates in", "DIR")
+	getopt.FlagLong(&hashFlag, "hash", 0, "hash algorithm used to find duplicates, md5 or sha256", "ALGORITHM")
+	getopt.FlagLong(&cacheFlag, "cache", 0, "file to keep the duplicate hashes in between runs", "FILE")
+	getopt.FlagLong(&structuralDupFlag, "structural-dup", 0, "also find duplicates that only differ in metadata or formatting")
+	getopt.FlagLong(&aspectFlag, "aspect", 0, "required aspect ratio, e.g. 1:1, or any", "W:H")
+	getopt.FlagLong(&maxBytes, "max-bytes", 0, "largest tile file size allowed", "N")
+	getopt.FlagLong(&maxImageBytes, "max-image-bytes", 0, "largest embedded raster image allowed", "N")
+	getopt.FlagLong(&requireLicenseFlag, "require-license", 0, "license URL every tile must declare", "URL")
+	getopt.FlagLong(&fontsFlag, "fonts", 0, "comma separated list of allowed font families", "FONTS")
+	getopt.FlagLong(&paletteFlag, "palette", 0, "file of the colors tiles may use", "FILE")
+	getopt.FlagLong(&maxNodes, "max-nodes", 0, "maximum number of elements in a tile", "N")
+	getopt.FlagLong(&maxPrecision, "max-precision", 0, "maximum decimal places in path coordinates", "N")
+	getopt.FlagLong(&minStrokeFlag, "min-stroke", 0, "minimum stroke width in px", "PX")
+	getopt.FlagLong(&editorNsFlag, "editor-namespaces", 0, "comma separated list of editor namespace URIs", "URIS")
+	getopt.FlagLong(&excludeFlag, "exclude", 0, "glob pattern of paths to skip, may be repeated", "PATTERN")
+	getopt.FlagLong(&includeFlag, "include", 0, "glob pattern of the files to check, may be repeated", "PATTERN")
+	getopt.FlagLong(&followSymlinksFlag, "follow-symlinks", 0, "descend into symbolic links to directories")
+	getopt.FlagLong(&maxDepthFlag, "max-depth", 0, "maximum number of directories to descend", "N")
+	getopt.FlagLong(&baselineFlag, "baseline", 0, "don't report the known results recorded in FILE", "FILE")
+	getopt.FlagLong(&writeBaselineFlag, "write-baseline", 0, "record the current results in the --baseline file")
+	getopt.FlagLong(&failFastFlag, "fail-fast", 0, "stop at the first error")
+	getopt.FlagLong(&filesFromFlag, "files-from", 0, "check the files listed in FILE, - for stdin", "FILE")
+	getopt.FlagLong(&filesFrom0Flag, "files-from0", 0, "like --files-from with the paths separated by NUL bytes", "FILE")
+	getopt.FlagLong(&listFlag, "list", 0, "list the files and checks that would be run and exit")
+	getopt.FlagLong(&listFlag, "dry-run", 0, "same as --list")
 }
 
-func usage() {
-	fmt.Printf("Usage: %s [-?] [-v] <check-directory> <duplicate-directory>\n", filepath.Base(os.Args[0]))
-	fmt.Printf("    -?                         display this help message\n")
-	fmt.Printf("    -v                         output additional execution information\n")
-	fmt.Printf("    <check-directory>          path to the directory tree to check\n")
-	fmt.Printf("    <duplication-directory>    path to the directory tree to look for duplicates\n")
+// usage prints the command line help to w, stdout when it was asked for and
+// stderr when the command line was wrong.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [-?] [-V] [--config FILE] [-v] [-q] [-j | --csv | --sarif] [--junit FILE] [-o FILE] [--root DIR] [--no-color] [--progress] [-W] [--min-width N] [--min-height N] [--min-keywords N] [--only CHECKS | --skip CHECKS] [--severity CHECK=LEVEL]... [--lang LANGS] [--no-spell] [--allow-words FILE] [--dump-words FILE] [--manifest FILE] [--jobs N] [--dup-dir DIR] [--hash ALGORITHM] [--cache FILE] [--structural-dup] [--aspect W:H] [--max-bytes N] [--max-image-bytes N] [--require-license URL] [--fonts FONTS] [--palette FILE] [--max-nodes N] [--max-precision N] [--min-stroke PX] [--editor-namespaces URIS] [--exclude PATTERN]... [--include PATTERN]... [--follow-symlinks] [--max-depth N] [--baseline FILE [--write-baseline]] [--fail-fast] [--list] <check-path>... | --files-from FILE | --files-from0 FILE\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "    -?                         display this help message\n")
+	fmt.Fprintf(w, "    -V, --version              display version information and exit\n")
+	fmt.Fprintf(w, "    --config FILE              read options from the YAML file FILE, with the\n")
+	fmt.Fprintf(w, "                               long flag names as keys, flags given on the\n")
+	fmt.Fprintf(w, "                               command line take precedence (default\n")
+	fmt.Fprintf(w, "                               chktiles.yaml in the check directory, if any)\n")
+	fmt.Fprintf(w, "    -v                         output additional execution information, such as\n")
+	fmt.Fprintf(w, "                               the time spent in each check\n")
+	fmt.Fprintf(w, "    -q, --quiet                leave warnings out of the results, unless -W is\n")
+	fmt.Fprintf(w, "                               given, the summary still counts them\n")
+	fmt.Fprintf(w, "    -j, --json                 output the results as a JSON array\n")
+	fmt.Fprintf(w, "    --csv                      output the results as CSV with a header row\n")
+	fmt.Fprintf(w, "    --sarif                    output the results as a SARIF 2.1.0 log for code\n")
+	fmt.Fprintf(w, "                               scanning tools\n")
+	fmt.Fprintf(w, "    --junit FILE               also write a JUnit XML report with a testcase for\n")
+	fmt.Fprintf(w, "                               each file to FILE, - writes it to stdout instead\n")
+	fmt.Fprintf(w, "                               of the results\n")
+	fmt.Fprintf(w, "    -o, --output FILE          write the results to FILE instead of stdout, any\n")
+	fmt.Fprintf(w, "                               missing directories are created\n")
+	fmt.Fprintf(w, "    --root DIR                 report the paths of the checked files relative to\n")
+	fmt.Fprintf(w, "                               DIR, paths outside it are made absolute (default\n")
+	fmt.Fprintf(w, "                               the check directory, when there is only one)\n")
+	fmt.Fprintf(w, "    --no-color                 don't color the severities, they are only colored\n")
+	fmt.Fprintf(w, "                               on a terminal and when NO_COLOR isn't set\n")
+	fmt.Fprintf(w, "    --progress                 show the number of files checked so far on stderr,\n")
+	fmt.Fprintf(w, "                               only when running on a terminal\n")
+	fmt.Fprintf(w, "    -W, --warnings-as-errors   exit with a non-zero status when warnings are found\n")
+	fmt.Fprintf(w, "    --min-width N              minimum tile width in px, 0 disables (default 80)\n")
+	fmt.Fprintf(w, "    --min-height N             minimum tile height in px, 0 disables (default 80)\n")
+	fmt.Fprintf(w, "    --min-keywords N           warn about tiles with fewer than N non-empty\n")
+	fmt.Fprintf(w, "                               keywords, 0 only requires some (default 0)\n")
+	fmt.Fprintf(w, "    --only CHECKS              comma separated list of checks to run, one of\n")
+	fmt.Fprintf(w, "                               %s\n", strings.Join(chklib.CheckNames(), ", "))
+	fmt.Fprintf(w, "    --skip CHECKS              comma separated list of checks not to run, one of\n")
+	fmt.Fprintf(w, "                               %s\n", strings.Join(chklib.CheckNames(), ", "))
+	fmt.Fprintf(w, "    --severity CHECK=LEVEL     report every result of CHECK with the severity\n")
+	fmt.Fprintf(w, "                               LEVEL, error or warning, may be repeated or comma\n")
+	fmt.Fprintf(w, "                               separated\n")
+	fmt.Fprintf(w, "    --lang LANGS               comma separated list of aspell dictionaries, a word\n")
+	fmt.Fprintf(w, "                               is correct if any of them accept it (default en_US)\n")
+	fmt.Fprintf(w, "    --no-spell                 turn off the spelling checks, for machines without\n")
+	fmt.Fprintf(w, "                               aspell. Without --lang they are also turned off,\n")
+	fmt.Fprintf(w, "                               with a warning, when the dictionary can't be loaded\n")
+	fmt.Fprintf(w, "    --allow-words FILE         file of words, one per line, that are never reported\n")
+	fmt.Fprintf(w, "                               as misspelled (alias --dictionary)\n")
+	fmt.Fprintf(w, "    --dump-words FILE          write the misspelled words found to FILE, one per\n")
+	fmt.Fprintf(w, "                               line, so that they can be reviewed and added to\n")
+	fmt.Fprintf(w, "                               the --allow-words file\n")
+	fmt.Fprintf(w, "    --manifest FILE            write the path, identifier, title, keywords, size\n")
+	fmt.Fprintf(w, "                               and hash of each tile checked to FILE as a JSON\n")
+	fmt.Fprintf(w, "                               array, tiles that can't be parsed are left out\n")
+	fmt.Fprintf(w, "    --jobs N                   number of files to check in parallel (default %d)\n", runtime.NumCPU())
+	fmt.Fprintf(w, "    --dup-dir DIR              directory tree to look for duplicates of the checked\n")
+	fmt.Fprintf(w, "                               files in, the duplicates check is skipped if it\n")
+	fmt.Fprintf(w, "                               isn't given\n")
+	fmt.Fprintf(w, "    --hash ALGORITHM           hash used to find duplicate content, md5 or sha256\n")
+	fmt.Fprintf(w, "                               (default md5)\n")
+	fmt.Fprintf(w, "    --cache FILE               keep the hashes of the files compared for duplicates\n")
+	fmt.Fprintf(w, "                               in FILE, so that unchanged files aren't hashed again\n")
+	fmt.Fprintf(w, "                               on the next run\n")
+	fmt.Fprintf(w, "    --structural-dup           also report tiles with the same structure as a\n")
+	fmt.Fprintf(w, "                               duplicate, ignoring comments, metadata, titles,\n")
+	fmt.Fprintf(w, "                               editor namespaces, whitespace, attribute order and\n")
+	fmt.Fprintf(w, "                               id names\n")
+	fmt.Fprintf(w, "    --aspect W:H               required tile aspect ratio, e.g. 1:1 or 4:3, or any\n")
+	fmt.Fprintf(w, "                               to skip the check (default any)\n")
+	fmt.Fprintf(w, "    --max-bytes N              size in bytes above which tile files are reported,\n")
+	fmt.Fprintf(w, "                               0 disables (default 0)\n")
+	fmt.Fprintf(w, "    --max-image-bytes N        size in bytes above which embedded raster images are\n")
+	fmt.Fprintf(w, "                               reported, 0 reports all of them (default 0)\n")
+	fmt.Fprintf(w, "    --require-license URL      cc:license URL that every tile must declare\n")
+	fmt.Fprintf(w, "    --fonts FONTS              comma separated list of the font families tiles may\n")
+	fmt.Fprintf(w, "                               use, if not given any font is allowed\n")
+	fmt.Fprintf(w, "    --palette FILE             file of the colors tiles may use for fills and\n")
+	fmt.Fprintf(w, "                               strokes, one hex code per line, if not given any\n")
+	fmt.Fprintf(w, "                               color is allowed\n")
+	fmt.Fprintf(w, "    --max-nodes N              maximum number of elements in a tile, 0 disables\n")
+	fmt.Fprintf(w, "                               (default 10000)\n")
+	fmt.Fprintf(w, "    --max-precision N          maximum decimal places in path and polygon\n")
+	fmt.Fprintf(w, "                               coordinates (default 3)\n")
+	fmt.Fprintf(w, "    --min-stroke PX            minimum stroke width in px, 0 disables (default 0.5)\n")
+	fmt.Fprintf(w, "    --editor-namespaces URIS   comma separated list of editor namespace URIs that\n")
+	fmt.Fprintf(w, "                               should be stripped (default Inkscape, Sodipodi\n")
+	fmt.Fprintf(w, "                               and Adobe Illustrator)\n")
+	fmt.Fprintf(w, "    --exclude PATTERN          skip files and directories matching the glob PATTERN,\n")
+	fmt.Fprintf(w, "                               may be repeated. * and ? don't match /, ** matches\n")
+	fmt.Fprintf(w, "                               any number of directories. A pattern without a /\n")
+	fmt.Fprintf(w, "                               is matched against the base name, otherwise against\n")
+	fmt.Fprintf(w, "                               the path relative to the directory being walked.\n")
+	fmt.Fprintf(w, "                               Patterns are also read from a .chktilesignore file\n")
+	fmt.Fprintf(w, "                               at the root of the check directory.\n")
+	fmt.Fprintf(w, "    --include PATTERN          only check the files matching the glob PATTERN, may\n")
+	fmt.Fprintf(w, "                               be repeated. Patterns are matched like --exclude,\n")
+	fmt.Fprintf(w, "                               which wins when a file matches both. The duplicate\n")
+	fmt.Fprintf(w, "                               directory and files named directly aren't filtered\n")
+	fmt.Fprintf(w, "    --follow-symlinks          descend into symbolic links to directories in both\n")
+	fmt.Fprintf(w, "                               the check and duplicate directories, by default\n")
+	fmt.Fprintf(w, "                               they are not followed\n")
+	fmt.Fprintf(w, "    --max-depth N              how many directories to descend below the check and\n")
+	fmt.Fprintf(w, "                               duplicate directories, 0 only checks the files at\n")
+	fmt.Fprintf(w, "                               the top, -1 has no limit (default -1)\n")
+	fmt.Fprintf(w, "    --baseline FILE            don't report, or fail on, the results recorded in\n")
+	fmt.Fprintf(w, "                               the JSON file FILE, only new ones\n")
+	fmt.Fprintf(w, "    --write-baseline           record the current results in the --baseline file,\n")
+	fmt.Fprintf(w, "                               replacing what was there\n")
+	fmt.Fprintf(w, "    --fail-fast                stop checking files as soon as an error is found,\n")
+	fmt.Fprintf(w, "                               warnings don't stop the checks\n")
+	fmt.Fprintf(w, "    --files-from FILE          check the SVG files listed in FILE, one per line,\n")
+	fmt.Fprintf(w, "                               instead of walking check paths, - reads the list\n")
+	fmt.Fprintf(w, "                               from stdin\n")
+	fmt.Fprintf(w, "    --files-from0 FILE         like --files-from with the paths separated by NUL\n")
+	fmt.Fprintf(w, "                               bytes, as written by git diff -z and find -print0,\n")
+	fmt.Fprintf(w, "                               so they may contain spaces and newlines\n")
+	fmt.Fprintf(w, "    --list                     list the files that would be checked and the checks\n")
+	fmt.Fprintf(w, "                               that would run on them without checking anything,\n")
+	fmt.Fprintf(w, "                               with -v the file sizes and check descriptions are\n")
+	fmt.Fprintf(w, "                               also shown (alias --dry-run)\n")
+	fmt.Fprintf(w, "    <check-path>...            paths to the SVG files or directory trees to check,\n")
+	fmt.Fprintf(w, "                               .svgz files are decompressed before checking and a\n")
+	fmt.Fprintf(w, "                               file found more than once is checked once. - on its\n")
+	fmt.Fprintf(w, "                               own checks a single document read from stdin, which\n")
+	fmt.Fprintf(w, "                               isn't compared with the duplicate directory\n")
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "Checks can be turned off for a single file with a comment in the file such as\n")
+	fmt.Fprintf(w, "    <!-- chktiles:disable size,keyword-spelling -->\n")
+	fmt.Fprintf(w, "where \"chktiles:disable all\" turns off every check for that file.\n")
 }
 
-func printSvg(node *xmlquery.Node) {
-	var n *xmlquery.Node
-	n = xmlquery.FindOne(node, "//svg")
-	w := n.SelectAttr("width")
-	h := n.SelectAttr("height")
-	v := n.SelectAttr("viewBox")
-	fmt.Printf("  ** Width: %s, Height: %s, Viewbox: %s\n", w, h, v)
+// printVersion prints the version of chktiles along with the Go version it
+// was built with and, when the build recorded it, the commit it was built
+// from.
+func printVersion() {
+	fmt.Printf("%s %s (%s)\n", filepath.Base(os.Args[0]), version, runtime.Version())
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	revision := ""
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if revision != "" {
+		if modified {
+			revision += " (modified)"
+		}
+		fmt.Printf("commit %s\n", revision)
+	}
 }
 
-func parseSvg(reader io.Reader) (*xmlquery.Node , error) {
-	xmlDoc, err := xmlquery.Parse(reader)
-	if err != nil {
-		fmt.Printf("parseSvg: \tERROR\tcould not parse SVG file. %v\n", err)
-		return nil, err
+// createOutput creates, or truncates, the file at path for the results,
+// creating any missing parent directories.
+func createOutput(path string) (*os.File, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
 	}
 
-	return xmlDoc, nil
+	return os.Create(path)
 }
 
-func checkKeywords(path string, node *xmlquery.Node) {
-	var nodes []*xmlquery.Node
-	nodes = xmlquery.Find(node, "//rdf:li")
-	if len(nodes) == 0 {
-		fmt.Printf("%q\tERROR\tKeywords missing\n", path)
+// progressInterval is the minimum time between updates of the --progress
+// display.
+const progressInterval = 100 * time.Millisecond
+
+// newProgress returns a function that shows the number of files checked on
+// stderr, updating it at most every progressInterval.
+func newProgress() func(done int, total int) {
+	var last time.Time
+	return func(done int, total int) {
+		if time.Since(last) < progressInterval && done < total {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(os.Stderr, "\rChecked %d/%d files", done, total)
 	}
 }
 
-func checkSize(path string, node *xmlquery.Node) {
-	var n *xmlquery.Node
-	n = xmlquery.FindOne(node, "//svg")
-	w := toFloat(n.SelectAttr("width"))
-	h := toFloat(n.SelectAttr("height"))
+// hasErrors reports whether any of results should fail the run. Warnings
+// count as errors when -W is given.
+func hasErrors(results []chklib.Result) bool {
+	for _, r := range results {
+		if r.Severity == chklib.SeverityError || (warningsAsErrorsFlag && r.Severity == chklib.SeverityWarning) {
+			return true
+		}
+	}
 
-	if w < minWidth {
-		fmt.Printf("%q\tERROR\tWidth (%f) is too small\n", path, w)
+	return false
+}
+
+// filterResults returns the results that should be output, which leaves out
+// the warnings with -q unless -W makes them errors.
+func filterResults(results []chklib.Result) []chklib.Result {
+	if !quietFlag || warningsAsErrorsFlag {
+		return results
 	}
 
-	if h < minHeight {
-		fmt.Printf("%q\tERROR\tHeight (%f) is too small\n", path, h)
+	filtered := []chklib.Result{}
+	for _, r := range results {
+		if r.Severity != chklib.SeverityWarning {
+			filtered = append(filtered, r)
+		}
 	}
+	return filtered
 }
 
-func checkUnits(path string, node *xmlquery.Node) {
-	var n *xmlquery.Node
-	n = xmlquery.FindOne(node, "//svg")
-	w := n.SelectAttr("width")
-	h := n.SelectAttr("height")
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
 
-	if u := getUnitConversion(w); u != 1.0 {
-		fmt.Printf("%q\tWARNING\tWidth units are not px, %q\n", path, w)
+// colorSeverity returns severity wrapped in the color used for it, or as
+// it is if colors are off.
+func colorSeverity(severity string) string {
+	if !useColor {
+		return severity
 	}
 
-	if u := getUnitConversion(h); u != 1.0 {
-		fmt.Printf("%q\tWARNING\tHeight units are not px, %q\n", path, h)
-	}	
+	switch severity {
+	case chklib.SeverityError:
+		return colorRed + severity + colorReset
+	case chklib.SeverityWarning:
+		return colorYellow + severity + colorReset
+	}
+	return severity
 }
 
-func checkIdentifier(path string, node *xmlquery.Node) {
-	var n *xmlquery.Node
-	n = xmlquery.FindOne(node, "//dc:identifier")
-	if n == nil {
-		fmt.Printf("%q\tERROR\tIdentifier missing\n", path)		
+func printResults(w io.Writer, results []chklib.Result) {
+	for _, r := range results {
+		fmt.Fprintf(w, "%q\t%s\t%s\n", r.Path, colorSeverity(r.Severity), r.Message)
 	}
 }
 
-func checkKeywordSpelling(path string, node *xmlquery.Node) {
-	speller, err := aspell.NewSpeller(map[string]string{"lang": "en_US,"})
+// relativePath returns path relative to root for --root. A path outside
+// root is made absolute instead, and path is returned unchanged if root is
+// "" or it isn't a file.
+func relativePath(root string, path string) string {
+	if root == "" || path == "<stdin>" {
+		return path
+	}
+
+	absRoot, err := filepath.Abs(root)
 	if err != nil {
-		fmt.Printf("checkKeywordSpelling\tERROR\t%v\n", err)
-		return
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
 	}
-	defer speller.Delete()
 
-	var nodes []*xmlquery.Node
-	nodes = xmlquery.Find(node, "//rdf:li")
-	if len(nodes) == 0 {
-		return 
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return absPath
 	}
+	return rel
+}
 
-	var keywords []string
-	for _, n := range nodes {
-		keywords = append(keywords, n.InnerText())
+// relativeResults returns a copy of results with the paths made relative to
+// root.
+func relativeResults(root string, results []chklib.Result) []chklib.Result {
+	relative := make([]chklib.Result, len(results))
+	for i, r := range results {
+		r.Path = relativePath(root, r.Path)
+		relative[i] = r
 	}
+	return relative
+}
 
-	var misspelled []string
-	for _, keyword := range keywords {
-		if keyword != "" {
-			words := strings.Split(keyword, " ")
-			for _, word := range words {
-				if !speller.Check(word) {
-					misspelled = append(misspelled, word)
-				}
+// dumpWords writes the misspelled words in results to path for
+// --dump-words, lower cased, sorted and one per line like the --allow-words
+// file.
+func dumpWords(path string, results []chklib.Result) error {
+	seen := make(map[string]bool)
+	var words []string
+	for _, r := range results {
+		for _, word := range r.Words {
+			word = strings.ToLower(word)
+			if !seen[word] {
+				seen[word] = true
+				words = append(words, word)
 			}
 		}
 	}
+	sort.Strings(words)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	for _, word := range words {
+		fmt.Fprintln(f, word)
+	}
+	return f.Close()
+}
+
+// readFileList returns the paths listed one per line in the --files-from
+// file at path, or stdin for "-". Blank lines are skipped. With nul the paths
+// are separated by NUL bytes instead for --files-from0, and are used exactly
+// as given so that they may contain spaces and newlines. Every path must be
+// an existing SVG file, all the ones that aren't are reported.
+func readFileList(path string, nul bool) ([]string, error) {
+	r := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	paths := []string{}
+	bad := 0
+	scanner := bufio.NewScanner(r)
+	if nul {
+		scanner.Split(scanNul)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !nul {
+			line = strings.TrimSpace(line)
+		}
+		if line == "" {
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(line))
+		if info, err := os.Stat(line); err != nil {
+			fmt.Fprintf(os.Stderr, "readFileList\tERROR\tunable to access path %q, %v\n", line, err)
+			bad++
+		} else if info.IsDir() || (ext != ".svg" && ext != ".svgz") {
+			fmt.Fprintf(os.Stderr, "readFileList\tERROR\t%q is not an SVG file\n", line)
+			bad++
+		} else {
+			paths = append(paths, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
-	if len(misspelled) > 0 {
-		s := strings.Join(misspelled, ", ")
-		fmt.Printf("%q\tERROR\tKeywords misspelled: %s\n", path, s)
+	if bad > 0 {
+		return nil, fmt.Errorf("%q lists %d path(s) that can't be checked", path, bad)
 	}
+	return paths, nil
 }
 
-func checkTspanSpelling(path string, node *xmlquery.Node) {
-	speller, err := aspell.NewSpeller(map[string]string{"lang": "en_US,"})
+// scanNul is a bufio.SplitFunc that splits the input on NUL bytes.
+func scanNul(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// writeManifest writes tiles to path for --manifest as a JSON array sorted
+// by path.
+func writeManifest(path string, tiles []chklib.Tile) error {
+	sort.Slice(tiles, func(i, j int) bool {
+		return tiles[i].Path < tiles[j].Path
+	})
+
+	f, err := os.Create(path)
 	if err != nil {
-		fmt.Printf("checkKeywordSpelling\tERROR\t%v\n", err)
-		return
+		return err
 	}
-	defer speller.Delete()
 
-	var nodes []*xmlquery.Node
-	nodes = xmlquery.Find(node, "//svg:tspan")
-	if len(nodes) == 0 {
-		return 
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(tiles); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
+}
+
+// printList prints the checks that would be run and the files they would be
+// run on for --list, relative to root. The duplicates check is left out when
+// there is nothing to compare against. With -v the check descriptions and file sizes are
+// included.
+func printList(w io.Writer, checkPaths []string, dupDir string, root string, opts chklib.Options) error {
+	stdin := len(checkPaths) == 1 && checkPaths[0] == "-"
 
-	var tspans []string
-	for _, n := range nodes {
-		tspans = append(tspans, n.InnerText())
+	names, err := opts.SelectedChecks()
+	if err != nil {
+		return err
 	}
 
-	var misspelled []string
-	for _, tspan := range tspans {
-		if tspan != "" {
-			words := strings.Split(tspan, " ")
-			for _, word := range words {
-				if !speller.Check(strings.Replace(word, "/", "", -1)) {
-					misspelled = append(misspelled, word)
-				}
+	descriptions := make(map[string]string)
+	for _, chk := range chklib.Checks() {
+		descriptions[chk.Name] = chk.Description
+	}
+
+	fmt.Fprintf(w, "Checks:\n")
+	for _, name := range names {
+		if name == "duplicates" && (dupDir == "" || stdin) {
+			continue
+		}
+		if verboseFlag {
+			fmt.Fprintf(w, "    %-24s %s\n", name, descriptions[name])
+		} else {
+			fmt.Fprintf(w, "    %s\n", name)
+		}
+	}
+
+	files := []string{"<stdin>"}
+	if !stdin {
+		files, err = chklib.ListFiles(checkPaths, opts)
+	}
+
+	fmt.Fprintf(w, "Files:\n")
+	for _, path := range files {
+		if verboseFlag && !stdin {
+			if info, statErr := os.Stat(path); statErr == nil {
+				fmt.Fprintf(w, "    %s (%d bytes)\n", relativePath(root, path), info.Size())
+				continue
 			}
 		}
+		fmt.Fprintf(w, "    %s\n", relativePath(root, path))
 	}
 
-	if len(misspelled) > 0 {
-		s := strings.Join(misspelled, ", ")
-		fmt.Printf("%q\tERROR\tText misspelled: %s\n", path, s)
+	fmt.Fprintf(w, "%d files would be checked\n", len(files))
+	return err
+}
+
+// printSummary prints the number of errors and warnings found in files,
+// broken down per check when running verbosely. Nothing is printed if no
+// files were scanned.
+func printSummary(w io.Writer, results []chklib.Result, files int) {
+	if files == 0 {
+		return
+	}
+
+	totals := make(map[string]int)
+	perCheck := make(map[string]map[string]int)
+	for _, r := range results {
+		totals[r.Severity]++
+		if perCheck[r.Check] == nil {
+			perCheck[r.Check] = make(map[string]int)
+		}
+		perCheck[r.Check][r.Severity]++
+	}
+
+	fmt.Fprintf(w, "Scanned %d files: %d errors, %d warnings\n", files, totals[chklib.SeverityError], totals[chklib.SeverityWarning])
+
+	if verboseFlag {
+		var names []string
+		for name := range perCheck {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			counts := perCheck[name]
+			fmt.Fprintf(w, "    %-24s %d errors, %d warnings\n", name, counts[chklib.SeverityError], counts[chklib.SeverityWarning])
+		}
 	}
 }
 
-func makeHash(path string) string {
-	f, err := os.Open(path)
-	if err != nil {
-		fmt.Printf("makeHash\tERROR\tunable to open %q, %v\n", path, err)
-		return ""
+// printTimings writes the total time spent in each check, slowest first.
+func printTimings(w io.Writer, timings map[string]time.Duration) {
+	var names []string
+	for name := range timings {
+		names = append(names, name)
 	}
-  defer f.Close()
+	sort.Slice(names, func(i, j int) bool {
+		if timings[names[i]] != timings[names[j]] {
+			return timings[names[i]] > timings[names[j]]
+		}
+		return names[i] < names[j]
+	})
 
-	h := md5.New()
-	if _, err := io.Copy(h, f); err != nil {
-		fmt.Printf("makeHash\tERROR\tunable to create hash of %q, %v\n", path, err)
-		return ""
+	fmt.Fprintf(w, "Time spent in each check:\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "    %-24s %v\n", name, timings[name].Round(time.Microsecond))
 	}
+}
 
-	return hex.EncodeToString(h.Sum(nil))
+func printJSON(w io.Writer, results []chklib.Result) {
+	// HTML escaping is turned off so that paths such as <stdin> are
+	// written as they are.
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(results); err != nil {
+		fmt.Fprintf(os.Stderr, "printJSON\tERROR\tunable to encode results, %v\n", err)
+	}
 }
 
-func getFileSize(path string) int64 {
-	fi, err := os.Stat(path)
-	if err != nil {
-		fmt.Print("getFileSize\tERROR\tunable to get size of %q, %v\n", path, err)
-		return 0
+// printCSV writes the results as CSV with a header row, for importing into
+// a spreadsheet.
+func printCSV(w io.Writer, results []chklib.Result) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"path", "check", "severity", "message"})
+	for _, r := range results {
+		cw.Write([]string{r.Path, r.Check, r.Severity, r.Message})
 	}
 
-	return fi.Size()
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "printCSV\tERROR\tunable to write results, %v\n", err)
+	}
 }
 
-func checkDuplicates(checkPath string, dupDir string, node *xmlquery.Node) {
-	aHash := makeHash(checkPath)
-	aBasename := filepath.Base(checkPath)
-	aSize := getFileSize(checkPath)
+func main() {
+	getopt.Parse()
+
+	if helpFlag {
+		usage(os.Stdout)
+		os.Exit(0)
+	}
+
+	if versionFlag {
+		printVersion()
+		os.Exit(0)
+	}
 
-	err := filepath.Walk(dupDir, func(path string, info os.FileInfo, err error) error {
+	var cfg *config
+	if configPath := findConfig(configFlag, getopt.Args()); configPath != "" {
+		var err error
+		cfg, err = loadConfig(configPath)
 		if err != nil {
-			fmt.Printf("checkDuplicates\tERROR\tunable to access %q, %v\n", path, err)
-			return err
+			fmt.Fprintf(os.Stderr, "%s: unable to read the configuration %q, %v\n", filepath.Base(os.Args[0]), configPath, err)
+			os.Exit(1)
 		}
+		cfg.apply()
+	}
+
+	if verboseFlag {
+		fmt.Fprintf(os.Stderr, "nArgs: %d, Args: %s\n", len(os.Args), strings.Join(os.Args, ", "))
+	}
 
-		if filepath.Ext(path) != ".svg" {
-			return nil
+	if minWidth < 0 || minHeight < 0 {
+		fmt.Fprintf(os.Stderr, "%s: --min-width and --min-height must not be negative\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if jobsFlag < 1 {
+		fmt.Fprintf(os.Stderr, "%s: --jobs must be at least 1\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if maxBytes < 0 || maxImageBytes < 0 || maxNodes < 0 || maxPrecision < 0 {
+		fmt.Fprintf(os.Stderr, "%s: --max-bytes, --max-image-bytes, --max-nodes and --max-precision must not be negative\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if minKeywords < 0 {
+		fmt.Fprintf(os.Stderr, "%s: --min-keywords must not be negative\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if minStrokeFlag < 0 {
+		fmt.Fprintf(os.Stderr, "%s: --min-stroke must not be negative\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	formats := 0
+	for _, set := range []bool{jsonFlag, csvFlag, sarifFlag, junitFlag == "-"} {
+		if set {
+			formats++
 		}
+	}
+	if formats > 1 {
+		fmt.Fprintf(os.Stderr, "%s: --json, --csv, --sarif and --junit - are mutually exclusive\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
 
-		if aBasename == filepath.Base(path) {
-			fmt.Printf("%q\tWARNING\tduplicate file name %q\n", checkPath, path)
+	if maxDepthFlag < -1 {
+		fmt.Fprintf(os.Stderr, "%s: --max-depth must be -1 or more\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if writeBaselineFlag && baselineFlag == "" {
+		fmt.Fprintf(os.Stderr, "%s: --write-baseline needs --baseline\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	if len(onlyFlag) > 0 && len(skipFlag) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: --only and --skip are mutually exclusive\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+
+	severity := make(map[string]string)
+	if cfg != nil {
+		for name, level := range cfg.Severity {
+			severity[name] = level
 		}
+	}
+	for _, entry := range severityFlag {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(os.Stderr, "%s: --severity %q is not of the form CHECK=LEVEL\n", filepath.Base(os.Args[0]), entry)
+			usage(os.Stderr)
+			os.Exit(1)
+		}
+		severity[strings.TrimSpace(parts[0])] = parts[1]
+	}
+
+	// files records every file checked, including those that couldn't be
+	// opened or parsed, for the summary and the JUnit report.
+	var filesMu sync.Mutex
+	var files []string
+
+	opts := chklib.Options{
+		Checks:           onlyFlag,
+		Skip:             skipFlag,
+		Severity:         severity,
+		Verbose:          verboseFlag,
+		MinWidth:         minWidth,
+		MinHeight:        minHeight,
+		MinKeywords:      minKeywords,
+		Lang:             langFlag,
+		SpellingOptional: !getopt.IsSet("lang") && (cfg == nil || cfg.Lang == nil),
+		NoSpelling:       noSpellFlag,
+		AllowWordsFile:   allowWordsFlag,
+		Jobs:             jobsFlag,
+		Hash:             hashFlag,
+		Cache:            cacheFlag,
+		StructuralDup:    structuralDupFlag,
+		Aspect:           aspectFlag,
+		MaxBytes:         maxBytes,
+		MaxImageBytes:    maxImageBytes,
+		RequireLicense:   requireLicenseFlag,
+		Fonts:            fontsFlag,
+		PaletteFile:      paletteFlag,
+		MaxNodes:         maxNodes,
+		MaxPrecision:     maxPrecision,
+		MinStroke:        minStrokeFlag,
+		EditorNamespaces: editorNsFlag,
+		Exclude:          excludeFlag,
+		Include:          includeFlag,
+		FollowSymlinks:   followSymlinksFlag,
+		MaxDepth:         maxDepthFlag,
+		FailFast:         failFastFlag,
+		OnFile: func(path string) {
+			filesMu.Lock()
+			files = append(files, path)
+			filesMu.Unlock()
+		},
+	}
 
-		if aSize == getFileSize(path) {
-			fmt.Printf("%q\tWARNING\tduplicate file size %q\n", checkPath, path)
+	// The tiles are collected for --manifest.
+	var tilesMu sync.Mutex
+	tiles := []chklib.Tile{}
+	if manifestFlag != "" {
+		opts.OnTile = func(tile chklib.Tile) {
+			tilesMu.Lock()
+			tiles = append(tiles, tile)
+			tilesMu.Unlock()
 		}
+	}
 
-		if aHash == makeHash(path) {
-			fmt.Printf("%q\tWARNING\tduplicate file hash %q\n", checkPath, path)
+	// The time spent in each check is totalled for -v.
+	var timingsMu sync.Mutex
+	timings := make(map[string]time.Duration)
+	if verboseFlag {
+		opts.OnCheck = func(name string, elapsed time.Duration) {
+			timingsMu.Lock()
+			timings[name] += elapsed
+			timingsMu.Unlock()
 		}
+	}
 
-		return nil
-	})
+	if progressFlag && isTerminal(os.Stdout) && isTerminal(os.Stderr) {
+		opts.Progress = newProgress()
+	}
 
-	if err != nil {
-		fmt.Printf("checkDuplicates\tERROR\tunable to walk directory %q, %v\n", dupDir, err)
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+		usage(os.Stderr)
+		os.Exit(1)
 	}
-}
 
-func checkTiles(checkDir string, dupDir string) error {
-	err := filepath.Walk(checkDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Printf("checkTiles\tERROR\tunable to access path %q, %v\n", path, err)
-			return err
+	args := getopt.Args()
+	if filesFromFlag != "" && filesFrom0Flag != "" {
+		fmt.Fprintf(os.Stderr, "%s: --files-from and --files-from0 are mutually exclusive\n", filepath.Base(os.Args[0]))
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	if filesFromFlag != "" || filesFrom0Flag != "" {
+		flag, listPath := "--files-from", filesFromFlag
+		if filesFrom0Flag != "" {
+			flag, listPath = "--files-from0", filesFrom0Flag
+		}
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %s can't be combined with check paths\n", filepath.Base(os.Args[0]), flag)
+			usage(os.Stderr)
+			os.Exit(1)
 		}
 
-		if filepath.Ext(path) != ".svg" {
-			return nil
+		var listErr error
+		args, listErr = readFileList(listPath, filesFrom0Flag != "")
+		if listErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s %s\n", filepath.Base(os.Args[0]), flag, listErr)
+			os.Exit(1)
 		}
+	} else if len(args) < 1 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
 
-		if verboseFlag {
-			fmt.Printf("checkTiles%q\n", path)
+	for _, path := range args {
+		if path == "-" && len(args) > 1 {
+			fmt.Fprintf(os.Stderr, "%s: - can't be combined with other check paths\n", filepath.Base(os.Args[0]))
+			usage(os.Stderr)
+			os.Exit(1)
 		}
+	}
 
-		file, err := os.Open(path)
+	// The output is created before the checks are run so that a bad path
+	// is reported straight away.
+	out := os.Stdout
+	if outputFlag != "" {
+		f, err := createOutput(outputFlag)
 		if err != nil {
-			fmt.Printf("checkTiles\tERROR\tunable to open %q, %v\n", path, err)
-			return err
+			fmt.Fprintf(os.Stderr, "%s: unable to create %q, %v\n", filepath.Base(os.Args[0]), outputFlag, err)
+			os.Exit(1)
+		}
+		out = f
+	}
+
+	useColor = !noColorFlag && os.Getenv("NO_COLOR") == "" && isTerminal(out)
+
+	// Paths are reported relative to the root, which defaults to the check
+	// directory when only one is checked.
+	root := rootFlag
+	if !getopt.IsSet("root") && root == "" && len(args) == 1 {
+		if info, statErr := os.Stat(args[0]); statErr == nil && info.IsDir() {
+			root = args[0]
 		}
-		defer file.Close()
+	}
 
-		rootNode, err := parseSvg(file)
+	if listFlag {
+		err := printList(out, args, dupDirFlag, root, opts)
+		if out != os.Stdout {
+			if closeErr := out.Close(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "%s: unable to write %q, %v\n", filepath.Base(os.Args[0]), outputFlag, closeErr)
+				os.Exit(1)
+			}
+		}
 		if err != nil {
-			return err
+			os.Exit(1)
 		}
+		os.Exit(0)
+	}
 
+	var results []chklib.Result
+	var err error
+	if len(args) == 1 && args[0] == "-" {
+		results, err = chklib.CheckReader(os.Stdin, "<stdin>", opts)
+	} else {
+		results, err = chklib.CheckTrees(args, dupDirFlag, opts)
+	}
+
+	// Clear the progress line so that it doesn't get mixed up with the
+	// results.
+	if opts.Progress != nil {
+		fmt.Fprintf(os.Stderr, "\r\x1b[K")
+	}
+	if results == nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
+	}
+
+	results = relativeResults(root, results)
+	for i, path := range files {
+		files[i] = relativePath(root, path)
+	}
+
+	if writeBaselineFlag {
+		if baselineErr := writeBaseline(baselineFlag, results); baselineErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to write the baseline %q, %v\n", filepath.Base(os.Args[0]), baselineFlag, baselineErr)
+			os.Exit(1)
+		}
+	}
+
+	if baselineFlag != "" {
+		known, baselineErr := loadBaseline(baselineFlag)
+		if baselineErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to read the baseline %q, %v\n", filepath.Base(os.Args[0]), baselineFlag, baselineErr)
+			os.Exit(1)
+		}
+
+		var suppressed int
+		results, suppressed = applyBaseline(results, known)
 		if verboseFlag {
-			printSvg(rootNode)
+			fmt.Fprintf(os.Stderr, "%d known results left out by the baseline %q\n", suppressed, baselineFlag)
 		}
+	}
 
-		checkKeywords(path, rootNode)
-		checkSize(path, rootNode)
-		checkUnits(path, rootNode)
-		checkIdentifier(path, rootNode)
-		checkKeywordSpelling(path, rootNode)
-		checkTspanSpelling(path, rootNode)
-		checkDuplicates(path, dupDir, rootNode)
+	shown := filterResults(results)
 
-		return nil
-	})
+	if junitFlag != "" {
+		if junitErr := printJUnit(out, junitFlag, shown, files); junitErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to write the JUnit report, %v\n", filepath.Base(os.Args[0]), junitErr)
+			if err == nil {
+				err = junitErr
+			}
+		}
+	}
 
-	if err != nil {
-		fmt.Printf("checkTiles\tERROR\tunable to walk directory %q, %v\n", checkDir, err)
+	if jsonFlag {
+		printJSON(out, shown)
+	} else if csvFlag {
+		printCSV(out, shown)
+	} else if sarifFlag {
+		printSARIF(out, shown)
+	} else if junitFlag != "-" {
+		printResults(out, shown)
+		printSummary(out, results, len(files))
 	}
 
-	return err
-}
+	if verboseFlag {
+		printTimings(os.Stderr, timings)
+	}
 
-func main() {
-	getopt.Parse()
+	if manifestFlag != "" {
+		described := make(map[string]bool)
+		for i := range tiles {
+			tiles[i].Path = relativePath(root, tiles[i].Path)
+			described[tiles[i].Path] = true
+		}
+		for _, path := range files {
+			if !described[path] {
+				fmt.Fprintf(os.Stderr, "writeManifest\tWARNING\t%q left out of the manifest, it can't be parsed\n", path)
+			}
+		}
 
-	if helpFlag {
-		usage()
-		os.Exit(0)
+		if manifestErr := writeManifest(manifestFlag, tiles); manifestErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to write %q, %v\n", filepath.Base(os.Args[0]), manifestFlag, manifestErr)
+			if err == nil {
+				err = manifestErr
+			}
+		}
 	}
 
-	if verboseFlag {
-		fmt.Printf("nArgs: %d, Args: %s\n", len(os.Args), strings.Join(os.Args, ", "))
+	if dumpWordsFlag != "" {
+		if dumpErr := dumpWords(dumpWordsFlag, results); dumpErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to write %q, %v\n", filepath.Base(os.Args[0]), dumpWordsFlag, dumpErr)
+			if err == nil {
+				err = dumpErr
+			}
+		}
 	}
 
-	args := getopt.Args()
-	if len(args) < 2 {
-		usage()
-		os.Exit(1)
+	if out != os.Stdout {
+		if closeErr := out.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to write %q, %v\n", filepath.Base(os.Args[0]), outputFlag, closeErr)
+			os.Exit(1)
+		}
 	}
 
-	checkTiles(args[0], args[1])
+	if hasErrors(results) || err != nil {
+		os.Exit(1)
+	}
 
 	os.Exit(0)
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pborman/getopt/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName is the configuration file looked for in the check
+// directory when --config isn't given.
+const configFileName = "chktiles.yaml"
+
+// config holds the options that can be set in a configuration file. The
+// keys are the long flag names and a value is only used when the flag isn't
+// given on the command line. Options left out of the file are nil. Severity
+// maps check names to levels and is merged with --severity, which wins for
+// the checks named in both.
+type config struct {
+	Verbose          *bool             `yaml:"verbose"`
+	Quiet            *bool             `yaml:"quiet"`
+	JSON             *bool             `yaml:"json"`
+	CSV              *bool             `yaml:"csv"`
+	SARIF            *bool             `yaml:"sarif"`
+	JUnit            *string           `yaml:"junit"`
+	Output           *string           `yaml:"output"`
+	Root             *string           `yaml:"root"`
+	NoColor          *bool             `yaml:"no-color"`
+	Progress         *bool             `yaml:"progress"`
+	WarningsAsErrors *bool             `yaml:"warnings-as-errors"`
+	MinWidth         *int              `yaml:"min-width"`
+	MinHeight        *int              `yaml:"min-height"`
+	MinKeywords      *int              `yaml:"min-keywords"`
+	Only             []string          `yaml:"only"`
+	Skip             []string          `yaml:"skip"`
+	Severity         map[string]string `yaml:"severity"`
+	Lang             []string          `yaml:"lang"`
+	NoSpell          *bool             `yaml:"no-spell"`
+	AllowWords       *string           `yaml:"allow-words"`
+	DumpWords        *string           `yaml:"dump-words"`
+	Manifest         *string           `yaml:"manifest"`
+	Jobs             *int              `yaml:"jobs"`
+	DupDir           *string           `yaml:"dup-dir"`
+	Hash             *string           `yaml:"hash"`
+	Cache            *string           `yaml:"cache"`
+	StructuralDup    *bool             `yaml:"structural-dup"`
+	Aspect           *string           `yaml:"aspect"`
+	MaxBytes         *int              `yaml:"max-bytes"`
+	MaxImageBytes    *int              `yaml:"max-image-bytes"`
+	RequireLicense   *string           `yaml:"require-license"`
+	Fonts            []string          `yaml:"fonts"`
+	Palette          *string           `yaml:"palette"`
+	MaxNodes         *int              `yaml:"max-nodes"`
+	MaxPrecision     *int              `yaml:"max-precision"`
+	MinStroke        *float64          `yaml:"min-stroke"`
+	EditorNamespaces []string          `yaml:"editor-namespaces"`
+	Exclude          []string          `yaml:"exclude"`
+	Include          []string          `yaml:"include"`
+	FollowSymlinks   *bool             `yaml:"follow-symlinks"`
+	MaxDepth         *int              `yaml:"max-depth"`
+	Baseline         *string           `yaml:"baseline"`
+	FailFast         *bool             `yaml:"fail-fast"`
+}
+
+// loadConfig reads the configuration file at path. Unknown keys are an
+// error so that a misspelled option isn't silently ignored.
+func loadConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// Files named in the configuration are relative to it rather than to
+	// wherever chktiles is run from.
+	dir := filepath.Dir(path)
+	for _, p := range []*string{cfg.JUnit, cfg.Output, cfg.Root, cfg.AllowWords, cfg.DumpWords, cfg.Manifest, cfg.DupDir, cfg.Cache, cfg.Baseline, cfg.Palette} {
+		if p != nil && *p != "" && *p != "-" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// findConfig returns the configuration file to use, the --config file if
+// it was given or else chktiles.yaml in the first check path if that is a
+// directory with one. "" means there is no configuration file.
+func findConfig(configPath string, args []string) string {
+	if configPath != "" {
+		return configPath
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		return ""
+	}
+	if info, err := os.Stat(args[0]); err != nil || !info.IsDir() {
+		return ""
+	}
+
+	path := filepath.Join(args[0], configFileName)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// apply sets the flags that weren't given on the command line from cfg.
+// The output formats, and --only and --skip, each go together, so that one
+// of them given on the command line replaces any of the others from the
+// file instead of conflicting with it.
+func (cfg *config) apply() {
+	if !isFlagSet("json") && !isFlagSet("csv") && !isFlagSet("sarif") {
+		setBool("json", &jsonFlag, cfg.JSON)
+		setBool("csv", &csvFlag, cfg.CSV)
+		setBool("sarif", &sarifFlag, cfg.SARIF)
+	}
+	if !isFlagSet("only") && !isFlagSet("skip") {
+		setStrings("only", &onlyFlag, cfg.Only)
+		setStrings("skip", &skipFlag, cfg.Skip)
+	}
+
+	setBool("verbose", &verboseFlag, cfg.Verbose)
+	setBool("quiet", &quietFlag, cfg.Quiet)
+	setString("junit", &junitFlag, cfg.JUnit)
+	setString("output", &outputFlag, cfg.Output)
+	setString("root", &rootFlag, cfg.Root)
+	setBool("no-color", &noColorFlag, cfg.NoColor)
+	setBool("progress", &progressFlag, cfg.Progress)
+	setBool("warnings-as-errors", &warningsAsErrorsFlag, cfg.WarningsAsErrors)
+	setInt("min-width", &minWidth, cfg.MinWidth)
+	setInt("min-height", &minHeight, cfg.MinHeight)
+	setInt("min-keywords", &minKeywords, cfg.MinKeywords)
+	setStrings("lang", &langFlag, cfg.Lang)
+	setBool("no-spell", &noSpellFlag, cfg.NoSpell)
+	setString("allow-words", &allowWordsFlag, cfg.AllowWords)
+	setString("dump-words", &dumpWordsFlag, cfg.DumpWords)
+	setString("manifest", &manifestFlag, cfg.Manifest)
+	setInt("jobs", &jobsFlag, cfg.Jobs)
+	setString("dup-dir", &dupDirFlag, cfg.DupDir)
+	setString("hash", &hashFlag, cfg.Hash)
+	setString("cache", &cacheFlag, cfg.Cache)
+	setBool("structural-dup", &structuralDupFlag, cfg.StructuralDup)
+	setString("aspect", &aspectFlag, cfg.Aspect)
+	setInt("max-bytes", &maxBytes, cfg.MaxBytes)
+	setInt("max-image-bytes", &maxImageBytes, cfg.MaxImageBytes)
+	setString("require-license", &requireLicenseFlag, cfg.RequireLicense)
+	setStrings("fonts", &fontsFlag, cfg.Fonts)
+	setString("palette", &paletteFlag, cfg.Palette)
+	setInt("max-nodes", &maxNodes, cfg.MaxNodes)
+	setInt("max-precision", &maxPrecision, cfg.MaxPrecision)
+	setFloat("min-stroke", &minStrokeFlag, cfg.MinStroke)
+	setStrings("editor-namespaces", &editorNsFlag, cfg.EditorNamespaces)
+	setStrings("exclude", &excludeFlag, cfg.Exclude)
+	setStrings("include", &includeFlag, cfg.Include)
+	setBool("follow-symlinks", &followSymlinksFlag, cfg.FollowSymlinks)
+	setInt("max-depth", &maxDepthFlag, cfg.MaxDepth)
+	setString("baseline", &baselineFlag, cfg.Baseline)
+	setBool("fail-fast", &failFastFlag, cfg.FailFast)
+}
+
+// isFlagSet reports whether the flag with the long name was given on the
+// command line, under any of its names. -v has no long name so it is looked
+// up by its short one.
+func isFlagSet(name string) bool {
+	switch name {
+	case "verbose":
+		return getopt.IsSet('v')
+	case "allow-words":
+		return getopt.IsSet("allow-words") || getopt.IsSet("dictionary")
+	}
+	return getopt.IsSet(name)
+}
+
+func setBool(name string, flag *bool, value *bool) {
+	if value != nil && !isFlagSet(name) {
+		*flag = *value
+	}
+}
+
+func setInt(name string, flag *int, value *int) {
+	if value != nil && !isFlagSet(name) {
+		*flag = *value
+	}
+}
+
+func setFloat(name string, flag *float64, value *float64) {
+	if value != nil && !isFlagSet(name) {
+		*flag = *value
+	}
+}
+
+func setString(name string, flag *string, value *string) {
+	if value != nil && !isFlagSet(name) {
+		*flag = *value
+	}
+}
+
+func setStrings(name string, flag *[]string, value []string) {
+	if value != nil && !isFlagSet(name) {
+		*flag = value
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dqdgit/chktiles/chklib"
+)
+
+// The JUnit XML report understood by most CI systems. Each checked file is
+// a testcase, which fails if any errors were found in it.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// writeJUnit writes a JUnit report with a testcase for each of files and for
+// any other path that has results. Errors, and warnings with -W, are
+// reported as the testcase's failure while other warnings go to its
+// system-out.
+func writeJUnit(w io.Writer, results []chklib.Result, files []string) error {
+	byPath := make(map[string][]chklib.Result)
+	for _, r := range results {
+		byPath[r.Path] = append(byPath[r.Path], r)
+	}
+	for _, path := range files {
+		if _, ok := byPath[path]; !ok {
+			byPath[path] = nil
+		}
+	}
+
+	var paths []string
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	suite := junitTestSuite{Name: "chktiles"}
+	for _, path := range paths {
+		tc := junitTestCase{Name: path, ClassName: "chktiles"}
+
+		var failures []string
+		var output []string
+		for _, r := range byPath[path] {
+			line := fmt.Sprintf("%s %s: %s", r.Severity, r.Check, r.Message)
+			if r.Severity == chklib.SeverityError || (warningsAsErrorsFlag && r.Severity == chklib.SeverityWarning) {
+				failures = append(failures, line)
+			} else {
+				output = append(output, line)
+			}
+		}
+
+		if len(failures) > 0 {
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d problem(s) found", len(failures)),
+				Type:    chklib.SeverityError,
+				Text:    strings.Join(failures, "\n"),
+			}
+			suite.Failures++
+		}
+		if len(output) > 0 {
+			tc.SystemOut = &junitOutput{strings.Join(output, "\n")}
+		}
+
+		suite.TestCases = append(suite.TestCases, tc)
+		suite.Tests++
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// printJUnit writes the JUnit report to path, or to out if path is "-".
+func printJUnit(out io.Writer, path string, results []chklib.Result, files []string) error {
+	if path == "-" {
+		return writeJUnit(out, results, files)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeJUnit(f, results, files); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dqdgit/chktiles/chklib"
+)
+
+// The subset of the SARIF 2.1.0 format needed to report the results to code
+// scanning tools such as GitHub's.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifURI converts path to the URI form SARIF expects. Relative paths stay
+// relative so that code scanning can resolve them against the repository.
+func sarifURI(path string) string {
+	uri := filepath.ToSlash(path)
+	if filepath.IsAbs(path) {
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		uri = "file://" + uri
+	}
+	return uri
+}
+
+// sarifFileRules are the rules for the results that aren't reported by one
+// of the checks, but about the file itself or its chktiles:disable comments.
+var sarifFileRules = []sarifRule{
+	{"open", "open", sarifMessage{"The file can be opened"}},
+	{"parse", "parse", sarifMessage{"The file is well formed XML"}},
+	{"parseDirectives", "parseDirectives", sarifMessage{"chktiles:disable comments name known checks"}},
+}
+
+// printSARIF prints the results as a SARIF log with a rule for each check,
+// and for each of the other kinds of result.
+func printSARIF(w io.Writer, results []chklib.Result) {
+	driver := sarifDriver{Name: "chktiles", Version: version, Rules: []sarifRule{}}
+	for _, chk := range chklib.Checks() {
+		driver.Rules = append(driver.Rules, sarifRule{chk.ID, chk.Name, sarifMessage{chk.Description}})
+	}
+	driver.Rules = append(driver.Rules, sarifFileRules...)
+
+	run := sarifRun{Tool: sarifTool{driver}, Results: []sarifResult{}}
+	for _, r := range results {
+		location := sarifLocation{sarifPhysicalLocation{sarifArtifactLocation{sarifURI(r.Path)}}}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    r.Check,
+			Level:     strings.ToLower(r.Severity),
+			Message:   sarifMessage{r.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(log); err != nil {
+		fmt.Fprintf(os.Stderr, "printSARIF\tERROR\tunable to encode results, %v\n", err)
+	}
+}